@@ -1,6 +1,7 @@
 package clog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"time"
@@ -127,6 +128,75 @@ func Criticalf(format string, v ...interface{}) {
 	cilog.StdLogger().Log(2, cilog.CRITICAL, fmt.Sprintf(format, v...), time.Now())
 }
 
+type traceIDKey struct{}
+
+// WithTraceID : returns a copy of ctx carrying traceID, used by the *fCtx functions
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID : trace ID of ctx, empty if not set
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+func ctxMsg(ctx context.Context, format string, v ...interface{}) string {
+	msg := fmt.Sprintf(format, v...)
+	if id := TraceID(ctx); id != "" {
+		return "[" + id + "] " + msg
+	}
+	return msg
+}
+
+// DebugfCtx : like Debugf1 with the trace ID of ctx
+func DebugfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.DEBUG, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// ReportfCtx : like Reportf1 with the trace ID of ctx
+func ReportfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.REPORT, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// InfofCtx : like Infof1 with the trace ID of ctx
+func InfofCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.INFO, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// SuccessfCtx : like Successf1 with the trace ID of ctx
+func SuccessfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.SUCCESS, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// WarningfCtx : like Warningf1 with the trace ID of ctx
+func WarningfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.WARNING, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// ErrorfCtx : like Errorf1 with the trace ID of ctx
+func ErrorfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.ERROR, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// FailfCtx : like Failf1 with the trace ID of ctx
+func FailfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.FAIL, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// ExceptionfCtx : like Exceptionf1 with the trace ID of ctx
+func ExceptionfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.EXCEPTION, ctxMsg(ctx, format, v...), time.Now())
+}
+
+// CriticalfCtx : like Criticalf1 with the trace ID of ctx
+func CriticalfCtx(ctx context.Context, format string, v ...interface{}) {
+	cilog.StdLogger().Log(2, cilog.CRITICAL, ctxMsg(ctx, format, v...), time.Now())
+}
+
 // IsDebugEnable :
 func IsDebugEnable() bool {
 	return cilog.GetMinLevel() == cilog.DEBUG
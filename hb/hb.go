@@ -8,6 +8,7 @@ import (
 	"net"
 
 	"github.com/castisdev/gcommon/clog"
+	"github.com/castisdev/gcommon/metrics"
 )
 
 const (
@@ -20,11 +21,36 @@ type HeartBeatResponser struct {
 	representativeIP string
 	localIP          string
 	processState     int32
+	requests         *metrics.CounterVec
+	errors           *metrics.CounterVec
 }
 
 // NewHeartBeatResponser :
 func NewHeartBeatResponser(representativeIP, localIP string) *HeartBeatResponser {
-	return &HeartBeatResponser{representativeIP, localIP, 0}
+	return &HeartBeatResponser{representativeIP: representativeIP, localIP: localIP}
+}
+
+// RegisterMetrics : registers metrics of heartbeat requests, names are prefixed with namespace,
+// e.g. "myapp_heartbeat_requests_total". it should be called before ListenAndServe.
+func (h *HeartBeatResponser) RegisterMetrics(r *metrics.Registry, namespace string) error {
+	p := "heartbeat_"
+	if namespace != "" {
+		p = namespace + "_" + p
+	}
+	requests := metrics.NewCounter(p+"requests_total", "Total number of heartbeat requests responded.")
+	errors := metrics.NewCounterVec(p+"errors_total", "Total number of heartbeat errors by the reason.", "reason")
+	if err := r.Register(requests, errors); err != nil {
+		return err
+	}
+	h.requests = requests
+	h.errors = errors
+	return nil
+}
+
+func (h *HeartBeatResponser) countError(reason string) {
+	if h.errors != nil {
+		h.errors.WithLabelValues(reason).Inc()
+	}
 }
 
 // ListenAndServe :
@@ -44,6 +70,7 @@ func (h *HeartBeatResponser) ListenAndServe(listenAddr string) error {
 		n, addr, err := udpConn.ReadFromUDP(readBuffer)
 		if err != nil {
 			clog.Errorf("failed to read, %v", err)
+			h.countError("read")
 			continue
 		}
 		remoteEP := ""
@@ -52,11 +79,13 @@ func (h *HeartBeatResponser) ListenAndServe(listenAddr string) error {
 		}
 		if n != 8 {
 			clog.Warningf1(remoteEP, "invalid msg size, %d", n)
+			h.countError("invalid_msg")
 			continue
 		}
 		_, seq, err := readMsgTypeSeq(readBuffer[:n])
 		if err != nil {
 			clog.Errorf1(remoteEP, "%v", err)
+			h.countError("invalid_msg")
 			continue
 		}
 
@@ -85,12 +114,17 @@ func (h *HeartBeatResponser) ListenAndServe(listenAddr string) error {
 		n, err = udpConn.WriteToUDP(w.Bytes(), addr)
 		if err != nil {
 			clog.Errorf1(remoteEP, "%v", err)
+			h.countError("write")
 			continue
 		}
 		if n != toWriten {
 			clog.Errorf1(remoteEP, "invalid write size, %d, %d", toWriten, n)
+			h.countError("write")
 			continue
 		}
+		if h.requests != nil {
+			h.requests.Inc()
+		}
 	}
 }
 
@@ -0,0 +1,233 @@
+package hutil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/gcommon/clog"
+)
+
+// CombinedLogFormat : nginx "combined" log_format
+const CombinedLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// AccessLogger : writes one line per request in nginx log_format.
+// supported variables are $remote_addr, $remote_user, $time_local, $time_iso8601, $msec, $request, $request_method,
+// $request_uri, $uri, $args, $server_protocol, $host, $status, $body_bytes_sent, $request_length, $request_time,
+// $request_id, $http_<name>(request header) and $sent_http_<name>(response header),
+// and $first_byte_time(time to first byte in seconds, not in nginx).
+// request_length is the request body bytes read by the handler.
+type AccessLogger struct {
+	w     io.Writer // nil: clog in info level
+	parts []accessLogPart
+}
+
+type accessLogPart struct {
+	literal  string
+	variable string
+}
+
+// NewAccessLogger : if w is nil, lines are written with clog
+func NewAccessLogger(format string, w io.Writer) (*AccessLogger, error) {
+	parts, err := parseAccessLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLogger{w: w, parts: parts}, nil
+}
+
+// NewAccessLogFileLogger : lines are written to the rotating log file of cilog, e.g. dir/2006-01/2006-01-02_module.log
+func NewAccessLogFileLogger(format, dir, module string, rotateSize int64) (*AccessLogger, error) {
+	return NewAccessLogger(format, cilog.NewLogWriter(dir, module, rotateSize))
+}
+
+func parseAccessLogFormat(format string) ([]accessLogPart, error) {
+	var parts []accessLogPart
+	var lit strings.Builder
+	for i := 0; i < len(format); {
+		if format[i] != '$' {
+			lit.WriteByte(format[i])
+			i++
+			continue
+		}
+		var name string
+		if i+1 < len(format) && format[i+1] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("failed to parse log format, unclosed variable at %d", i)
+			}
+			name = format[i+2 : i+end]
+			i += end + 1
+		} else {
+			j := i + 1
+			for j < len(format) && isAccessLogVarChar(format[j]) {
+				j++
+			}
+			name = format[i+1 : j]
+			i = j
+		}
+		if name == "" {
+			return nil, fmt.Errorf("failed to parse log format, empty variable name")
+		}
+		if !isAccessLogVar(name) {
+			return nil, fmt.Errorf("failed to parse log format, unknown variable $%s", name)
+		}
+		if lit.Len() > 0 {
+			parts = append(parts, accessLogPart{literal: lit.String()})
+			lit.Reset()
+		}
+		parts = append(parts, accessLogPart{variable: name})
+	}
+	if lit.Len() > 0 {
+		parts = append(parts, accessLogPart{literal: lit.String()})
+	}
+	return parts, nil
+}
+
+func isAccessLogVarChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func isAccessLogVar(name string) bool {
+	switch name {
+	case "remote_addr", "remote_user", "time_local", "time_iso8601", "msec", "request", "request_method",
+		"request_uri", "uri", "args", "server_protocol", "host", "status", "body_bytes_sent", "request_length",
+		"request_time", "request_id", "first_byte_time":
+		return true
+	}
+	return strings.HasPrefix(name, "http_") || strings.HasPrefix(name, "sent_http_")
+}
+
+// Handler : logs the requests handled by h, only the access log line for each request
+func (l *AccessLogger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := newLogResponseWriter(w, requestTraceID(r), "", r)
+		lw.quiet = true
+		defer l.Log(r, lw)
+		h.ServeHTTP(WrapResponseWriter(lw, w), r)
+	})
+}
+
+// Log : writes an access log line of the request served with w
+func (l *AccessLogger) Log(r *http.Request, w *LogResponseWriter) {
+	line := l.Format(r, w, time.Now())
+	if l.w == nil {
+		clog.Infof("%s", line)
+		return
+	}
+	if _, err := io.WriteString(l.w, line+"\n"); err != nil {
+		clog.Errorf("failed to write access log, %v", err)
+	}
+}
+
+// Format : access log line of the request served with w, finished at now
+func (l *AccessLogger) Format(r *http.Request, w *LogResponseWriter, now time.Time) string {
+	var b strings.Builder
+	for _, p := range l.parts {
+		if p.variable == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		v := accessLogVar(p.variable, r, w, now)
+		if v == "" {
+			v = "-"
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+func accessLogVar(name string, r *http.Request, w *LogResponseWriter, now time.Time) string {
+	switch name {
+	case "remote_addr":
+		return remoteIP(r)
+	case "remote_user":
+		user, _, _ := r.BasicAuth()
+		return escapeAccessLog(user)
+	case "time_local":
+		return now.Format("02/Jan/2006:15:04:05 -0700")
+	case "time_iso8601":
+		return now.Format("2006-01-02T15:04:05-07:00")
+	case "msec":
+		return fmt.Sprintf("%d.%03d", now.Unix(), now.Nanosecond()/int(time.Millisecond))
+	case "request":
+		return escapeAccessLog(r.Method + " " + r.RequestURI + " " + r.Proto)
+	case "request_method":
+		return escapeAccessLog(r.Method)
+	case "request_uri":
+		return escapeAccessLog(r.RequestURI)
+	case "uri":
+		return escapeAccessLog(r.URL.Path)
+	case "args":
+		return escapeAccessLog(r.URL.RawQuery)
+	case "server_protocol":
+		return escapeAccessLog(r.Proto)
+	case "host":
+		return escapeAccessLog(r.Host)
+	case "status":
+		return strconv.Itoa(w.Status())
+	case "body_bytes_sent":
+		return strconv.FormatInt(w.BytesWritten(), 10)
+	case "request_length":
+		return strconv.FormatInt(w.RequestBytes(), 10)
+	case "request_time":
+		return formatSeconds(now.Sub(w.start))
+	case "first_byte_time":
+		if d := w.TimeToFirstByte(); d > 0 {
+			return formatSeconds(d)
+		}
+		return ""
+	case "request_id":
+		return escapeAccessLog(w.reqID)
+	}
+	if strings.HasPrefix(name, "sent_http_") {
+		return escapeAccessLog(w.Header().Get(strings.Replace(name[len("sent_http_"):], "_", "-", -1)))
+	}
+	if strings.HasPrefix(name, "http_") {
+		return escapeAccessLog(r.Header.Get(strings.Replace(name[len("http_"):], "_", "-", -1)))
+	}
+	return ""
+}
+
+// formatSeconds : seconds with a milliseconds resolution, e.g. 0.012
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%d.%03d", d/time.Second, d%time.Second/time.Millisecond)
+}
+
+// escapeAccessLog : escapes '"', '\' and non-printable characters as \xXX like nginx
+func escapeAccessLog(s string) string {
+	var b *strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c < 0x7f && c != '"' && c != '\\' {
+			if b != nil {
+				b.WriteByte(c)
+			}
+			continue
+		}
+		if b == nil {
+			b = &strings.Builder{}
+			b.WriteString(s[:i])
+		}
+		fmt.Fprintf(b, "\\x%02X", c)
+	}
+	if b == nil {
+		return s
+	}
+	return b.String()
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,118 @@
+package hutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/gcommon/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccessLogger_invalidFormat(t *testing.T) {
+	_, err := NewAccessLogger(`$remote_addr $unknown`, nil)
+	assert.NotNil(t, err)
+	_, err = NewAccessLogger(`${status`, nil)
+	assert.NotNil(t, err)
+	_, err = NewAccessLogger(`$ status`, nil)
+	assert.NotNil(t, err)
+}
+
+func TestAccessLogger_Format(t *testing.T) {
+	l, err := NewAccessLogger(CombinedLogFormat, nil)
+	require.Nil(t, err)
+
+	r := httptest.NewRequest("POST", "/a/b?c=d", strings.NewReader("hello"))
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.SetBasicAuth("user", "pass")
+	r.Header.Set("Referer", `http://ref/"x"`)
+	r.Header.Set("User-Agent", "ua/1.0")
+
+	rec := httptest.NewRecorder()
+	w := newLogResponseWriter(rec, "id", "", r)
+	ioutil.ReadAll(r.Body)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("0123456789"))
+
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.FixedZone("KST", 9*3600))
+	assert.Equal(t, `1.2.3.4 - user [04/Mar/2024:05:06:07 +0900] "POST /a/b?c=d HTTP/1.1" 201 10 "http://ref/\x22x\x22" "ua/1.0"`,
+		l.Format(r, w, now))
+
+	l, err = NewAccessLogger(`${request_method}:$uri?$args $request_length $request_id $sent_http_content_type $http_x_none`, nil)
+	require.Nil(t, err)
+	w.Header().Set("Content-Type", "text/plain")
+	assert.Equal(t, `POST:/a/b?c=d 5 id text/plain -`, l.Format(r, w, now))
+}
+
+func TestAccessLogger_Handler(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewAccessLogger(`$status $body_bytes_sent $request_length $request_time $first_byte_time`, &buf)
+	require.Nil(t, err)
+
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	r := httptest.NewRequest("PUT", "/", strings.NewReader("abc"))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	fields := strings.Fields(buf.String())
+	require.Len(t, fields, 5)
+	assert.Equal(t, "200", fields[0])
+	assert.Equal(t, "5", fields[1])
+	assert.Equal(t, "3", fields[2])
+	assert.True(t, fields[3] >= "0.020", fields[3])
+	assert.True(t, fields[4] >= "0.020", fields[4])
+
+	// nothing written
+	buf.Reset()
+	h = l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, strings.HasPrefix(buf.String(), "200 0 0 0.000 -"), buf.String())
+}
+
+func TestAccessLogger_HandlerClog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := cilog.GetWriter()
+	clog.SetWriter(&buf)
+	defer clog.SetWriter(prev)
+
+	l, err := NewAccessLogger(`$request $status`, nil)
+	require.Nil(t, err)
+	h := l.Handler(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/none", nil))
+
+	// only the access log line, not the log of LogResponseWriter
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1, buf.String())
+	assert.Contains(t, lines[0], "GET /none HTTP/1.1 404")
+}
+
+func TestNewAccessLogFileLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := NewAccessLogFileLogger(`$request_method $uri $status`, dir, "access", 1024*1024)
+	require.Nil(t, err)
+	h := l.Handler(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x", nil))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+	require.Nil(t, err)
+	assert.Equal(t, "GET /x 404\n", string(b))
+}
+
+func TestEscapeAccessLog(t *testing.T) {
+	assert.Equal(t, "abc", escapeAccessLog("abc"))
+	assert.Equal(t, `a\x22b\x5Cc\x0A`, escapeAccessLog("a\"b\\c\n"))
+}
@@ -0,0 +1,248 @@
+package hutil
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// BreakerState :
+type BreakerState int
+
+// BreakerState
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// String :
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// BreakerResult : result of a request reported to CircuitBreaker
+type BreakerResult int
+
+// BreakerResult
+const (
+	BreakerSuccess BreakerResult = iota
+	BreakerFailure
+	BreakerIgnored // neither success nor failure, e.g. canceled by the caller. only releases the probe in half-open state
+)
+
+// CircuitOpenError : returned without sending a request while the breaker of the host is open
+type CircuitOpenError struct {
+	Host  string
+	State BreakerState
+	Until time.Time // end of the cool-down, zero in half-open state
+}
+
+// Error :
+func (e *CircuitOpenError) Error() string {
+	if e.State == BreakerHalfOpen {
+		return fmt.Sprintf("circuit breaker of %s is half-open, too many probes", e.Host)
+	}
+	return fmt.Sprintf("circuit breaker of %s is open until %s", e.Host, e.Until.Format("15:04:05.000"))
+}
+
+// CircuitBreaker : per-host circuit breaker.
+// a closed breaker opens when ConsecutiveFailures or FailureRatio(of at least MinRequests requests in Interval)
+// is reached. an open breaker fails fast with *CircuitOpenError for CoolDown, and then becomes half-open
+// to let HalfOpenProbes requests through. it closes if all the probes succeed, otherwise opens again.
+type CircuitBreaker struct {
+	ConsecutiveFailures int     // 0: disabled
+	FailureRatio        float64 // 0: disabled
+	MinRequests         int
+	Interval            time.Duration // counts are cleared every Interval in closed state, 0: never
+	CoolDown            time.Duration
+	HalfOpenProbes      int
+	OnStateChange       func(host string, from, to BreakerState)
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
+
+// NewCircuitBreaker :
+func NewCircuitBreaker(consecutiveFailures int, failureRatio float64, coolDown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		ConsecutiveFailures: consecutiveFailures,
+		FailureRatio:        failureRatio,
+		MinRequests:         10,
+		Interval:            60 * time.Second,
+		CoolDown:            coolDown,
+		HalfOpenProbes:      1,
+	}
+}
+
+type hostBreaker struct {
+	state       BreakerState
+	generation  uint64
+	since       time.Time // start of the state or the counting interval
+	requests    int
+	failures    int
+	consecutive int
+	probes      int // in-flight probes in half-open state
+	succeeded   int // succeeded probes in half-open state
+}
+
+type breakerTransition struct {
+	host     string
+	from, to BreakerState
+}
+
+// State :
+func (cb *CircuitBreaker) State(host string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if hb, ok := cb.hosts[host]; ok {
+		return hb.state
+	}
+	return BreakerClosed
+}
+
+// Allow : returns *CircuitOpenError if a request to host is not allowed.
+// otherwise the result of the request must be reported with done.
+func (cb *CircuitBreaker) Allow(host string) (done func(result BreakerResult), err error) {
+	now := time.Now()
+	var tr []breakerTransition
+
+	cb.mu.Lock()
+	if cb.hosts == nil {
+		cb.hosts = make(map[string]*hostBreaker)
+	}
+	hb, ok := cb.hosts[host]
+	if !ok {
+		hb = &hostBreaker{since: now}
+		cb.hosts[host] = hb
+	}
+
+	switch hb.state {
+	case BreakerClosed:
+		if cb.Interval > 0 && now.Sub(hb.since) >= cb.Interval {
+			hb.reset(now)
+		}
+	case BreakerOpen:
+		until := hb.since.Add(cb.CoolDown)
+		if now.Before(until) {
+			cb.mu.Unlock()
+			return nil, &CircuitOpenError{Host: host, State: BreakerOpen, Until: until}
+		}
+		tr = append(tr, cb.setState(host, hb, BreakerHalfOpen, now))
+	}
+	if hb.state == BreakerHalfOpen {
+		if hb.probes >= cb.maxProbes() {
+			cb.mu.Unlock()
+			cb.notify(tr)
+			return nil, &CircuitOpenError{Host: host, State: BreakerHalfOpen}
+		}
+		hb.probes++
+	}
+	generation := hb.generation
+	cb.mu.Unlock()
+	cb.notify(tr)
+
+	return func(result BreakerResult) {
+		cb.report(host, generation, result)
+	}, nil
+}
+
+func (cb *CircuitBreaker) report(host string, generation uint64, result BreakerResult) {
+	now := time.Now()
+	var tr []breakerTransition
+
+	cb.mu.Lock()
+	hb := cb.hosts[host]
+	if hb == nil || hb.generation != generation {
+		// reported after the state changed
+		cb.mu.Unlock()
+		return
+	}
+	switch {
+	case result == BreakerIgnored:
+		if hb.state == BreakerHalfOpen {
+			hb.probes--
+		}
+	case hb.state == BreakerClosed:
+		hb.requests++
+		if result == BreakerSuccess {
+			hb.consecutive = 0
+		} else {
+			hb.failures++
+			hb.consecutive++
+			if cb.shouldTrip(hb) {
+				tr = append(tr, cb.setState(host, hb, BreakerOpen, now))
+			}
+		}
+	case hb.state == BreakerHalfOpen:
+		hb.probes--
+		if result != BreakerSuccess {
+			tr = append(tr, cb.setState(host, hb, BreakerOpen, now))
+		} else {
+			hb.succeeded++
+			if hb.succeeded >= cb.maxProbes() {
+				tr = append(tr, cb.setState(host, hb, BreakerClosed, now))
+			}
+		}
+	}
+	cb.mu.Unlock()
+	cb.notify(tr)
+}
+
+func (cb *CircuitBreaker) shouldTrip(hb *hostBreaker) bool {
+	if cb.ConsecutiveFailures > 0 && hb.consecutive >= cb.ConsecutiveFailures {
+		return true
+	}
+	if cb.FailureRatio > 0 && hb.requests >= cb.MinRequests &&
+		float64(hb.failures)/float64(hb.requests) >= cb.FailureRatio {
+		return true
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) maxProbes() int {
+	if cb.HalfOpenProbes < 1 {
+		return 1
+	}
+	return cb.HalfOpenProbes
+}
+
+func (cb *CircuitBreaker) setState(host string, hb *hostBreaker, to BreakerState, now time.Time) breakerTransition {
+	from := hb.state
+	hb.state = to
+	hb.generation++
+	hb.reset(now)
+	return breakerTransition{host: host, from: from, to: to}
+}
+
+func (cb *CircuitBreaker) notify(tr []breakerTransition) {
+	for _, t := range tr {
+		if t.to == BreakerOpen {
+			clog.Warningf("circuit breaker of %s, %s -> %s, cool-down %v", t.host, t.from, t.to, cb.CoolDown)
+		} else {
+			clog.Infof("circuit breaker of %s, %s -> %s", t.host, t.from, t.to)
+		}
+		if cb.OnStateChange != nil {
+			cb.OnStateChange(t.host, t.from, t.to)
+		}
+	}
+}
+
+func (hb *hostBreaker) reset(now time.Time) {
+	hb.since = now
+	hb.requests = 0
+	hb.failures = 0
+	hb.consecutive = 0
+	hb.probes = 0
+	hb.succeeded = 0
+}
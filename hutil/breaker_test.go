@@ -0,0 +1,137 @@
+package hutil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	cb := NewCircuitBreaker(3, 0, 50*time.Millisecond)
+	cb.OnStateChange = func(host string, from, to BreakerState) {
+		mu.Lock()
+		changes = append(changes, host+":"+from.String()+"->"+to.String())
+		mu.Unlock()
+	}
+
+	for i := 0; i < 3; i++ {
+		done, err := cb.Allow("a")
+		require.Nil(t, err)
+		done(BreakerFailure)
+	}
+	assert.Equal(t, BreakerOpen, cb.State("a"))
+	assert.Equal(t, BreakerClosed, cb.State("b"))
+
+	_, err := cb.Allow("a")
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, "a", openErr.Host)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// only one probe in half-open state
+	done, err := cb.Allow("a")
+	require.Nil(t, err)
+	assert.Equal(t, BreakerHalfOpen, cb.State("a"))
+	_, err = cb.Allow("a")
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, BreakerHalfOpen, openErr.State)
+
+	done(BreakerSuccess)
+	assert.Equal(t, BreakerClosed, cb.State("a"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"a:closed->open", "a:open->half-open", "a:half-open->closed"}, changes)
+}
+
+func TestCircuitBreaker_FailureRatio(t *testing.T) {
+	cb := NewCircuitBreaker(0, 0.5, time.Minute)
+	cb.MinRequests = 4
+
+	results := []BreakerResult{BreakerSuccess, BreakerFailure, BreakerSuccess, BreakerFailure}
+	for _, result := range results {
+		assert.Equal(t, BreakerClosed, cb.State("a"))
+		done, err := cb.Allow("a")
+		require.Nil(t, err)
+		done(result)
+	}
+	assert.Equal(t, BreakerOpen, cb.State("a"))
+}
+
+func TestCircuitBreaker_HalfOpenFailure(t *testing.T) {
+	cb := NewCircuitBreaker(1, 0, 10*time.Millisecond)
+	done, _ := cb.Allow("a")
+	done(BreakerFailure)
+	assert.Equal(t, BreakerOpen, cb.State("a"))
+
+	time.Sleep(20 * time.Millisecond)
+	done, err := cb.Allow("a")
+	require.Nil(t, err)
+	done(BreakerFailure)
+	assert.Equal(t, BreakerOpen, cb.State("a"))
+}
+
+func TestCircuitBreaker_Ignored(t *testing.T) {
+	cb := NewCircuitBreaker(2, 0, 10*time.Millisecond)
+
+	// ignored results don't reset the consecutive failures
+	done, _ := cb.Allow("a")
+	done(BreakerFailure)
+	done, _ = cb.Allow("a")
+	done(BreakerIgnored)
+	done, _ = cb.Allow("a")
+	done(BreakerFailure)
+	assert.Equal(t, BreakerOpen, cb.State("a"))
+
+	// canceled probe releases the slot, and the breaker stays half-open
+	time.Sleep(20 * time.Millisecond)
+	done, err := cb.Allow("a")
+	require.Nil(t, err)
+	_, err = cb.Allow("a")
+	assert.NotNil(t, err)
+	done(BreakerIgnored)
+	assert.Equal(t, BreakerHalfOpen, cb.State("a"))
+
+	done, err = cb.Allow("a")
+	require.Nil(t, err)
+	done(BreakerSuccess)
+	assert.Equal(t, BreakerClosed, cb.State("a"))
+}
+
+func TestHTTPClient_Breaker(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	cl := NewHTTPClient(5*time.Second, nil, nil)
+	cl.Breaker = NewCircuitBreaker(2, 0, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		resp, err := cl.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	_, err := cl.Do(req)
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	u, _ := url.Parse(ts.URL)
+	assert.Equal(t, u.Host, openErr.Host)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&n))
+}
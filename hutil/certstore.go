@@ -0,0 +1,350 @@
+package hutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	defaultCertExpiryWarning = 30 * 24 * time.Hour
+	certExpiryWarnInterval   = 24 * time.Hour
+)
+
+// CertFile : certificate and private key files in PEM
+type CertFile struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// CertStore : certificates selected by SNI for GetCertificate of tls.Config, e.g. getCertificateFn of NewHTTPServer.
+// the files are reloaded by Reload or Watch when modified, and the previous certificate is kept if the new files are invalid.
+type CertStore struct {
+	ExpiryWarning time.Duration // warns the certificates expiring within this, 0: 30 days
+
+	dir     string // rescanned on Reload if loaded by NewCertStoreFromDir
+	mu      sync.Mutex
+	entries []*certEntry
+	set     atomic.Value // *certSet, swapped on reload
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+type certEntry struct {
+	file     CertFile
+	certStat os.FileInfo
+	keyStat  os.FileInfo
+	cert     *tls.Certificate // nil if not loaded yet
+	warned   time.Time        // last expiry warning
+}
+
+// certSet : certificates by name(lower case, e.g. "www.example.com" or "*.example.com")
+type certSet struct {
+	certs  []*tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+// NewCertStore : loads files, the first certificate is used if no certificate matches SNI.
+// if more than one certificate has the same name, the former is used.
+func NewCertStore(files []CertFile) (*CertStore, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no certificate file")
+	}
+	s := &CertStore{}
+	for _, f := range files {
+		e := &certEntry{file: f}
+		if _, err := e.reload(); err != nil {
+			return nil, err
+		}
+		s.entries = append(s.entries, e)
+	}
+	s.set.Store(s.buildSet())
+	s.checkExpiry(time.Now())
+	return s, nil
+}
+
+// NewCertStoreFromDir : loads the pairs of certificate(.crt or .pem) and key(.key or -key.pem) of the same name in dir,
+// e.g. "example.com.crt" and "example.com.key". new pairs in dir are added on reload.
+func NewCertStoreFromDir(dir string) (*CertStore, error) {
+	files, err := scanCertDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no certificate in [%v]", dir)
+	}
+	s, err := NewCertStore(files)
+	if err != nil {
+		return nil, err
+	}
+	s.dir = dir
+	return s, nil
+}
+
+// LoadCertStore : loads yaml file of the certificate files, relative paths are from the directory of the yaml file, e.g.
+//
+//	# certs.yml
+//	- cert: example.com.crt
+//	  key: example.com.key
+//	- cert: /etc/ssl/wildcard.example.com.pem
+//	  key: /etc/ssl/wildcard.example.com-key.pem
+func LoadCertStore(path string) (*CertStore, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate list [%v], %v", path, err)
+	}
+	var files []CertFile
+	if err := yaml.UnmarshalStrict(b, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate list [%v], %v", path, err)
+	}
+	base := filepath.Dir(path)
+	for i := range files {
+		if files[i].Cert == "" || files[i].Key == "" {
+			return nil, fmt.Errorf("failed to parse certificate list [%v], cert and key are required", path)
+		}
+		if !filepath.IsAbs(files[i].Cert) {
+			files[i].Cert = filepath.Join(base, files[i].Cert)
+		}
+		if !filepath.IsAbs(files[i].Key) {
+			files[i].Key = filepath.Join(base, files[i].Key)
+		}
+	}
+	return NewCertStore(files)
+}
+
+// GetCertificate : certificate of the exact name or the wildcard name of SNI, or the first certificate
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.set.Load().(*certSet)
+	if name := strings.TrimSuffix(strings.ToLower(hello.ServerName), "."); name != "" {
+		if c, ok := set.byName[name]; ok {
+			return c, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if c, ok := set.byName["*"+name[i:]]; ok {
+				return c, nil
+			}
+		}
+	}
+	if len(set.certs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	return set.certs[0], nil
+}
+
+// Reload : reloads the modified files, and warns the expiring certificates.
+// the previous certificate is kept if the files are invalid, and the error is returned.
+func (s *CertStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []string
+	if s.dir != "" {
+		files, err := scanCertDir(s.dir)
+		if err != nil {
+			clog.Errorf("%v", err)
+			errs = append(errs, err.Error())
+		}
+		for _, f := range files {
+			if !s.hasFile(f) {
+				s.entries = append(s.entries, &certEntry{file: f})
+			}
+		}
+	}
+
+	changed := false
+	for _, e := range s.entries {
+		ok, err := e.reload()
+		if err != nil {
+			clog.Errorf("%v, the previous certificate is used", err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		if ok {
+			changed = true
+			clog.Infof("reloaded certificate [%v], names:%v, expires at %v",
+				e.file.Cert, certNames(e.cert.Leaf), e.cert.Leaf.NotAfter)
+		}
+	}
+	if changed {
+		s.set.Store(s.buildSet())
+	}
+	s.checkExpiry(time.Now())
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Watch : reloads every interval until Stop
+func (s *CertStore) Watch(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	s.stopCh = stopCh
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				s.Reload()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop : stops Watch
+func (s *CertStore) Stop() {
+	s.mu.Lock()
+	stopCh := s.stopCh
+	s.stopCh = nil
+	s.mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		s.wg.Wait()
+	}
+}
+
+func (s *CertStore) hasFile(f CertFile) bool {
+	for _, e := range s.entries {
+		if e.file == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CertStore) buildSet() *certSet {
+	set := &certSet{byName: make(map[string]*tls.Certificate)}
+	for _, e := range s.entries {
+		if e.cert == nil {
+			continue
+		}
+		set.certs = append(set.certs, e.cert)
+		for _, name := range certNames(e.cert.Leaf) {
+			name = strings.ToLower(name)
+			if _, ok := set.byName[name]; !ok {
+				set.byName[name] = e.cert
+			}
+		}
+	}
+	return set
+}
+
+// checkExpiry : warns the certificates expiring within ExpiryWarning, once a day for each certificate.
+// must be called with s.mu locked
+func (s *CertStore) checkExpiry(now time.Time) {
+	warning := s.ExpiryWarning
+	if warning <= 0 {
+		warning = defaultCertExpiryWarning
+	}
+	for _, e := range s.entries {
+		if e.cert == nil || now.Sub(e.warned) < certExpiryWarnInterval {
+			continue
+		}
+		notAfter := e.cert.Leaf.NotAfter
+		left := notAfter.Sub(now)
+		if left >= warning {
+			continue
+		}
+		if left <= 0 {
+			clog.Errorf("certificate [%v] expired at %v", e.file.Cert, notAfter)
+		} else {
+			clog.Warningf("certificate [%v] expires in %v, at %v", e.file.Cert, left.Truncate(time.Minute), notAfter)
+		}
+		e.warned = now
+	}
+}
+
+// reload : loads the files if modified, returns whether loaded
+func (e *certEntry) reload() (bool, error) {
+	certStat, err := os.Stat(e.file.Cert)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate [%v], %v", e.file.Cert, err)
+	}
+	keyStat, err := os.Stat(e.file.Key)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate [%v], %v", e.file.Cert, err)
+	}
+	if e.cert != nil && sameFileStat(e.certStat, certStat) && sameFileStat(e.keyStat, keyStat) {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(e.file.Cert, e.file.Key)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate [%v], %v", e.file.Cert, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false, fmt.Errorf("failed to load certificate [%v], %v", e.file.Cert, err)
+		}
+	}
+	e.cert, e.certStat, e.keyStat = &cert, certStat, keyStat
+	e.warned = time.Time{}
+	return true, nil
+}
+
+func sameFileStat(a, b os.FileInfo) bool {
+	return a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// certNames : DNS names, or the common name if none
+func certNames(c *x509.Certificate) []string {
+	if len(c.DNSNames) > 0 {
+		return c.DNSNames
+	}
+	if c.Subject.CommonName != "" {
+		return []string{c.Subject.CommonName}
+	}
+	return nil
+}
+
+// scanCertDir : pairs of certificate and key files of the same name in dir, sorted by name
+func scanCertDir(dir string) ([]CertFile, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate directory [%v], %v", dir, err)
+	}
+	exists := make(map[string]bool, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			exists[fi.Name()] = true
+		}
+	}
+	var files []CertFile
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasSuffix(name, "-key.pem") {
+			continue
+		}
+		ext := filepath.Ext(name)
+		if ext != ".crt" && ext != ".pem" {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		for _, key := range []string{base + ".key", base + "-key.pem"} {
+			if exists[key] {
+				files = append(files, CertFile{Cert: filepath.Join(dir, name), Key: filepath.Join(dir, key)})
+				break
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,134 @@
+package hutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/gcommon/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate : writes cert in PEM, and sets the modification time to be reloaded
+func writeTestCertificate(t *testing.T, cert tls.Certificate, certPath, keyPath string) {
+	b, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644))
+	require.Nil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600))
+	mt := time.Now().Add(time.Duration(time.Now().UnixNano() % int64(time.Hour)))
+	require.Nil(t, os.Chtimes(certPath, mt, mt))
+	require.Nil(t, os.Chtimes(keyPath, mt, mt))
+}
+
+func serialOf(t *testing.T, s *CertStore, serverName string) string {
+	c, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	require.Nil(t, err)
+	return c.Leaf.SerialNumber.String()
+}
+
+func TestNewCertStoreFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certstore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	notAfter := time.Now().Add(365 * 24 * time.Hour)
+	a := newTestCertificate(t, "a", notAfter, "a.example.com")
+	wild := newTestCertificate(t, "wild", notAfter, "*.example.com")
+	writeTestCertificate(t, a, filepath.Join(dir, "a.crt"), filepath.Join(dir, "a.key"))
+	writeTestCertificate(t, wild, filepath.Join(dir, "wild.pem"), filepath.Join(dir, "wild-key.pem"))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "nokey.crt"), []byte("x"), 0644))
+
+	s, err := NewCertStoreFromDir(dir)
+	require.Nil(t, err)
+
+	serial := func(c tls.Certificate) string { return c.Leaf.SerialNumber.String() }
+	assert.Equal(t, serial(a), serialOf(t, s, "a.example.com"))
+	assert.Equal(t, serial(a), serialOf(t, s, "A.Example.com."))
+	assert.Equal(t, serial(wild), serialOf(t, s, "b.example.com"))
+	// wildcard matches one label only, the first certificate is used
+	assert.Equal(t, serial(a), serialOf(t, s, "c.b.example.com"))
+	assert.Equal(t, serial(a), serialOf(t, s, ""))
+
+	// modified
+	a2 := newTestCertificate(t, "a2", notAfter, "a.example.com")
+	writeTestCertificate(t, a2, filepath.Join(dir, "a.crt"), filepath.Join(dir, "a.key"))
+	assert.Nil(t, s.Reload())
+	assert.Equal(t, serial(a2), serialOf(t, s, "a.example.com"))
+
+	// invalid files keep the previous certificate
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.key"), []byte("invalid"), 0600))
+	assert.NotNil(t, s.Reload())
+	assert.Equal(t, serial(a2), serialOf(t, s, "a.example.com"))
+	require.Nil(t, os.Remove(filepath.Join(dir, "a.key")))
+	assert.NotNil(t, s.Reload())
+	assert.Equal(t, serial(a2), serialOf(t, s, "a.example.com"))
+	writeTestCertificate(t, a2, filepath.Join(dir, "a.crt"), filepath.Join(dir, "a.key"))
+
+	// added
+	b := newTestCertificate(t, "b", notAfter, "b.example.com")
+	writeTestCertificate(t, b, filepath.Join(dir, "b.crt"), filepath.Join(dir, "b.key"))
+	assert.Nil(t, s.Reload())
+	assert.Equal(t, serial(b), serialOf(t, s, "b.example.com"))
+	assert.Equal(t, serial(wild), serialOf(t, s, "c.example.com"))
+
+	_, err = NewCertStoreFromDir(filepath.Join(dir, "none"))
+	assert.NotNil(t, err)
+}
+
+func TestLoadCertStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certstore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	c := newTestCertificate(t, "localhost", time.Now().Add(time.Hour), "localhost")
+	writeTestCertificate(t, c, filepath.Join(dir, "c.crt"), filepath.Join(dir, "c.key"))
+	path := filepath.Join(dir, "certs.yml")
+	require.Nil(t, ioutil.WriteFile(path, []byte("- cert: c.crt\n  key: "+filepath.Join(dir, "c.key")+"\n"), 0644))
+
+	s, err := LoadCertStore(path)
+	require.Nil(t, err)
+	assert.Equal(t, c.Leaf.SerialNumber.String(), serialOf(t, s, "localhost"))
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("- cert: c.crt\n"), 0644))
+	_, err = LoadCertStore(path)
+	assert.NotNil(t, err)
+	require.Nil(t, ioutil.WriteFile(path, []byte("- cert: none.crt\n  key: none.key\n"), 0644))
+	_, err = LoadCertStore(path)
+	assert.NotNil(t, err)
+}
+
+func TestCertStore_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certstore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	prev := cilog.GetWriter()
+	clog.SetWriter(&buf)
+	defer clog.SetWriter(prev)
+
+	certPath, keyPath := filepath.Join(dir, "c.crt"), filepath.Join(dir, "c.key")
+	c := newTestCertificate(t, "localhost", time.Now().Add(24*time.Hour), "localhost")
+	writeTestCertificate(t, c, certPath, keyPath)
+	s, err := NewCertStore([]CertFile{{Cert: certPath, Key: keyPath}})
+	require.Nil(t, err)
+	assert.Contains(t, buf.String(), "certificate ["+certPath+"] expires in")
+
+	s.Watch(10 * time.Millisecond)
+	defer s.Stop()
+	c2 := newTestCertificate(t, "localhost", time.Now().Add(24*time.Hour), "localhost")
+	writeTestCertificate(t, c2, certPath, keyPath)
+	assert.Eventually(t, func() bool {
+		return serialOf(t, s, "localhost") == c2.Leaf.SerialNumber.String()
+	}, 3*time.Second, 10*time.Millisecond)
+	s.Stop()
+}
@@ -0,0 +1,314 @@
+package hutil
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// heapInUse : overridden by tests
+var heapInUse = func() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse
+}
+
+// ConnTracker : tracks the connections of a server by ConnState, use ConnState as connStateFn of the server constructors.
+// connections over MaxPerIP from the same remote IP are closed as soon as accepted.
+// bytes of the connections are counted if the listener is wrapped by Listener.
+type ConnTracker struct {
+	MaxPerIP int // 0: no limit
+
+	mu       sync.Mutex
+	conns    map[net.Conn]*connEntry
+	perIP    map[string]int
+	rejected uint64
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+type connEntry struct {
+	conn    net.Conn
+	ip      string
+	state   http.ConnState
+	start   time.Time
+	changed time.Time
+	counter *countingConn // nil if not accepted by Listener of the tracker
+}
+
+// ConnInfo : connection in ConnSnapshot
+type ConnInfo struct {
+	RemoteAddr   string  `json:"remoteAddr"`
+	State        string  `json:"state"`
+	Age          float64 `json:"age"`          // seconds since accepted
+	StateAge     float64 `json:"stateAge"`     // seconds in the current state
+	BytesRead    int64   `json:"bytesRead"`    // -1 if not counted
+	BytesWritten int64   `json:"bytesWritten"` // -1 if not counted
+}
+
+// ConnSnapshot : connections of ConnTracker, the oldest first
+type ConnSnapshot struct {
+	Total    int            `json:"total"`
+	States   map[string]int `json:"states"`
+	PerIP    map[string]int `json:"perIP"`
+	Rejected uint64         `json:"rejected"` // connections closed by MaxPerIP
+	Conns    []ConnInfo     `json:"conns"`
+}
+
+// NewConnTracker :
+func NewConnTracker(maxPerIP int) *ConnTracker {
+	return &ConnTracker{
+		MaxPerIP: maxPerIP,
+		conns:    make(map[net.Conn]*connEntry),
+		perIP:    make(map[string]int),
+	}
+}
+
+// ConnState : for ConnState of http.Server
+func (t *ConnTracker) ConnState(c net.Conn, state http.ConnState) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		ip := connRemoteIP(c)
+		if t.MaxPerIP > 0 && t.perIP[ip] >= t.MaxPerIP {
+			t.rejected++
+			clog.Warningf("too many connections from %v, max:%d, closing", ip, t.MaxPerIP)
+			c.Close()
+			return
+		}
+		t.perIP[ip]++
+		t.conns[c] = &connEntry{conn: c, ip: ip, state: state, start: now, changed: now, counter: t.connCounter(c)}
+	case http.StateActive, http.StateIdle:
+		if e, ok := t.conns[c]; ok {
+			e.state, e.changed = state, now
+		}
+	case http.StateClosed, http.StateHijacked:
+		e, ok := t.conns[c]
+		if !ok {
+			return
+		}
+		delete(t.conns, c)
+		if t.perIP[e.ip]--; t.perIP[e.ip] <= 0 {
+			delete(t.perIP, e.ip)
+		}
+	}
+}
+
+// Len : number of connections
+func (t *ConnTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// LenByIP : number of connections from ip
+func (t *ConnTracker) LenByIP(ip string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.perIP[ip]
+}
+
+// ReapIdle : closes the keep-alive connections idle for idleFor or longer, returns the number of them
+func (t *ConnTracker) ReapIdle(idleFor time.Duration) int {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for c, e := range t.conns {
+		if e.state == http.StateIdle && now.Sub(e.changed) >= idleFor {
+			c.Close()
+			n++
+		}
+	}
+	return n
+}
+
+// ReapIdleOnMemoryPressure : checks the heap in use every interval until Stop,
+// and closes the connections idle for idleFor or longer if it's over heapLimit
+func (t *ConnTracker) ReapIdleOnMemoryPressure(heapLimit uint64, idleFor, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	t.stopCh = stopCh
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-tk.C:
+				if heap := heapInUse(); heap > heapLimit {
+					if n := t.ReapIdle(idleFor); n > 0 {
+						clog.Warningf("heap in use %d over %d, closed %d idle connections", heap, heapLimit, n)
+					}
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop : stops ReapIdleOnMemoryPressure
+func (t *ConnTracker) Stop() {
+	t.mu.Lock()
+	stopCh := t.stopCh
+	t.stopCh = nil
+	t.mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		t.wg.Wait()
+	}
+}
+
+// Snapshot :
+func (t *ConnTracker) Snapshot() *ConnSnapshot {
+	now := time.Now()
+	t.mu.Lock()
+	s := &ConnSnapshot{
+		Total:    len(t.conns),
+		States:   make(map[string]int),
+		PerIP:    make(map[string]int, len(t.perIP)),
+		Rejected: t.rejected,
+		Conns:    make([]ConnInfo, 0, len(t.conns)),
+	}
+	for ip, n := range t.perIP {
+		s.PerIP[ip] = n
+	}
+	for _, e := range t.conns {
+		s.States[e.state.String()]++
+		info := ConnInfo{
+			RemoteAddr:   e.conn.RemoteAddr().String(),
+			State:        e.state.String(),
+			Age:          now.Sub(e.start).Seconds(),
+			StateAge:     now.Sub(e.changed).Seconds(),
+			BytesRead:    -1,
+			BytesWritten: -1,
+		}
+		if e.counter != nil {
+			info.BytesRead = atomic.LoadInt64(&e.counter.read)
+			info.BytesWritten = atomic.LoadInt64(&e.counter.written)
+		}
+		s.Conns = append(s.Conns, info)
+	}
+	t.mu.Unlock()
+	sort.Slice(s.Conns, func(i, j int) bool { return s.Conns[i].Age > s.Conns[j].Age })
+	return s
+}
+
+// Handler : admin handler serving Snapshot in JSON, "?pretty=1" for indented JSON
+func (t *ConnTracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, r, http.StatusOK, t.Snapshot())
+	})
+}
+
+// Listener : wraps l to count bytes of the connections, e.g. Listener of HTTPServer.
+// the bytes are reported only by t, not by other trackers of the connections.
+func (t *ConnTracker) Listener(l net.Listener) net.Listener {
+	return &countingListener{Listener: l, owner: t}
+}
+
+type countingListener struct {
+	net.Listener
+	owner *ConnTracker
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: c, owner: l.owner}, nil
+}
+
+// countingConn : counts bytes read and written
+type countingConn struct {
+	net.Conn
+	owner   *ConnTracker // tracker of Listener
+	read    int64
+	written int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+// ReadFrom : keeps sendfile of *net.TCPConn
+func (c *countingConn) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{c.Conn}, r)
+	}
+	atomic.AddInt64(&c.written, n)
+	return n, err
+}
+
+// CloseWrite : used by http.Server to close connections gracefully
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// connCounter : countingConn of c accepted by Listener of t, also under TLS
+func (t *ConnTracker) connCounter(c net.Conn) *countingConn {
+	for c != nil {
+		switch v := c.(type) {
+		case *countingConn:
+			if v.owner != t {
+				return nil
+			}
+			return v
+		case interface{ NetConn() net.Conn }:
+			c = v.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func connRemoteIP(c net.Conn) string {
+	addr := c.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UnixAddr:
+		// all clients of unix domain socket are local
+		return "unix"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
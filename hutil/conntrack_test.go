@@ -0,0 +1,140 @@
+package hutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTrackedTestServer(t *testing.T, tracker *ConnTracker) *HTTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := &HTTPServer{
+		Srv: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}),
+			ConnState: tracker.ConnState,
+		},
+		Listener: tracker.Listener(l),
+	}
+	go s.Serve()
+	return s
+}
+
+// keepAliveGet : requests on c, and leaves it idle
+func keepAliveGet(c net.Conn) error {
+	if _, err := c.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		return err
+	}
+	res, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = ioutil.ReadAll(res.Body)
+	return err
+}
+
+func TestConnTracker(t *testing.T) {
+	tracker := NewConnTracker(2)
+	s := newTrackedTestServer(t, tracker)
+	defer s.Shutdown(time.Second)
+	addr := s.Listener.Addr().String()
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		defer c.Close()
+		require.Nil(t, keepAliveGet(c))
+		conns = append(conns, c)
+	}
+
+	// over MaxPerIP
+	c, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(3 * time.Second))
+	assert.NotNil(t, keepAliveGet(c))
+
+	assert.Eventually(t, func() bool {
+		return tracker.Snapshot().States["idle"] == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, tracker.Len())
+	assert.Equal(t, 2, tracker.LenByIP("127.0.0.1"))
+
+	w := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/conns", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var snap ConnSnapshot
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &snap))
+	assert.Equal(t, 2, snap.Total)
+	assert.Equal(t, uint64(1), snap.Rejected)
+	assert.Equal(t, map[string]int{"127.0.0.1": 2}, snap.PerIP)
+	require.Len(t, snap.Conns, 2)
+	assert.Equal(t, conns[0].LocalAddr().String(), snap.Conns[0].RemoteAddr)
+	for _, info := range snap.Conns {
+		assert.Equal(t, "idle", info.State)
+		assert.True(t, info.BytesRead > 0)
+		assert.True(t, info.BytesWritten > 0)
+	}
+
+	assert.Equal(t, 0, tracker.ReapIdle(time.Hour))
+	assert.Equal(t, 2, tracker.ReapIdle(0))
+	assert.Eventually(t, func() bool {
+		return tracker.Len() == 0
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, tracker.LenByIP("127.0.0.1"))
+}
+
+func TestConnTracker_ReapIdleOnMemoryPressure(t *testing.T) {
+	var heap uint64
+	prev := heapInUse
+	heapInUse = func() uint64 { return atomic.LoadUint64(&heap) }
+	defer func() {
+		heapInUse = prev
+	}()
+
+	tracker := NewConnTracker(0)
+	s := newTrackedTestServer(t, tracker)
+	defer s.Shutdown(time.Second)
+
+	c, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.Nil(t, err)
+	defer c.Close()
+	require.Nil(t, keepAliveGet(c))
+
+	tracker.ReapIdleOnMemoryPressure(100, 0, 10*time.Millisecond)
+	defer tracker.Stop()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, tracker.Len())
+
+	atomic.StoreUint64(&heap, 200)
+	assert.Eventually(t, func() bool {
+		return tracker.Len() == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestConnTracker_Listener_owner(t *testing.T) {
+	tracker := NewConnTracker(0)
+	other := NewConnTracker(0)
+	c, peer := net.Pipe()
+	defer peer.Close()
+	cc := &countingConn{Conn: c, owner: other}
+
+	// bytes counted by the listener of other tracker are not reported
+	tracker.ConnState(cc, http.StateNew)
+	other.ConnState(cc, http.StateNew)
+	assert.Equal(t, int64(-1), tracker.Snapshot().Conns[0].BytesRead)
+	assert.Equal(t, int64(0), other.Snapshot().Conns[0].BytesRead)
+}
@@ -0,0 +1,275 @@
+package hutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content : http.Handler serving a content with Range and conditional request(If-Match,
+// If-None-Match, If-Modified-Since, If-Unmodified-Since, If-Range) support
+type Content struct {
+	ReaderAt    io.ReaderAt
+	Size        int64
+	ContentType string
+	ModTime     time.Time // zero value: no Last-Modified
+	ETag        string    // quoted entity tag(e.g. `"abc"`, `W/"abc"`), empty: no ETag
+}
+
+// NewContent : content is read with ReadAt if it implements io.ReaderAt, otherwise with Seek and Read
+func NewContent(content io.ReadSeeker, contentType string, modtime time.Time, etag string) (*Content, error) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek content, %v", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek content, %v", err)
+	}
+	ra, ok := content.(io.ReaderAt)
+	if !ok {
+		ra = &readSeekerAt{rs: content}
+	}
+	return NewContentAt(ra, size, contentType, modtime, etag), nil
+}
+
+// NewContentAt :
+func NewContentAt(ra io.ReaderAt, size int64, contentType string, modtime time.Time, etag string) *Content {
+	return &Content{ReaderAt: ra, Size: size, ContentType: contentType, ModTime: modtime, ETag: etag}
+}
+
+// ServeContent : like http.ServeContent, but with an explicit content type and ETag
+func ServeContent(w http.ResponseWriter, r *http.Request, contentType string, modtime time.Time, etag string, content io.ReadSeeker) {
+	c, err := NewContent(content, contentType, modtime, etag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.ServeHTTP(w, r)
+}
+
+// ServeHTTP :
+func (c *Content) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	if c.ETag != "" {
+		h.Set("Etag", c.ETag)
+	}
+	if !isZeroTime(c.ModTime) {
+		h.Set("Last-Modified", c.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if code := c.checkPreconditions(r); code != 0 {
+		if code == http.StatusNotModified {
+			writeNotModified(w)
+		} else {
+			w.WriteHeader(code)
+		}
+		return
+	}
+
+	h.Set("Accept-Ranges", "bytes")
+	contentType := c.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && c.checkIfRange(r) {
+		ranges, err := ParseRange(rangeHeader, c.Size)
+		if err == ErrNotSatisfiableRange {
+			writeNotSatisfiableRange(w, c.Size)
+			return
+		}
+		if err == nil {
+			ranges = satisfiableRanges(ranges)
+			if len(ranges) == 0 {
+				writeNotSatisfiableRange(w, c.Size)
+				return
+			}
+			if sumRangesSize(ranges) <= c.Size {
+				ServeRanges(w, r, c.ReaderAt, c.Size, contentType, ranges)
+				return
+			}
+			// too many or overlapped ranges, serves full content
+		}
+		// invalid Range header is ignored
+	}
+
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.FormatInt(c.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, io.NewSectionReader(c.ReaderAt, 0, c.Size))
+	}
+}
+
+// checkPreconditions : returns 304, 412 or 0(no precondition matched)
+func (c *Content) checkPreconditions(r *http.Request) int {
+	isGetOrHead := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchETag(im, c.ETag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !isZeroTime(c.ModTime) {
+		if t, err := http.ParseTime(ius); err == nil && c.ModTime.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if matchETag(inm, c.ETag, false) {
+			if isGetOrHead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && isGetOrHead && !isZeroTime(c.ModTime) {
+		if t, err := http.ParseTime(ims); err == nil && !c.ModTime.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// checkIfRange : true if Range header should be applied
+func (c *Content) checkIfRange(r *http.Request) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if etag, _ := scanETag(ir); etag != "" {
+		// If-Range requires the strong comparison
+		return etagStrongMatch(etag, c.ETag)
+	}
+	if isZeroTime(c.ModTime) {
+		return false
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	return c.ModTime.Truncate(time.Second).Equal(t)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	if h.Get("Etag") != "" {
+		delete(h, "Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+func writeNotSatisfiableRange(w http.ResponseWriter, size int64) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	http.Error(w, ErrNotSatisfiableRange.Error(), http.StatusRequestedRangeNotSatisfiable)
+}
+
+func satisfiableRanges(ranges []HTTPRange) []HTTPRange {
+	var ret []HTTPRange
+	for _, r := range ranges {
+		if r.Length > 0 {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func sumRangesSize(ranges []HTTPRange) int64 {
+	var size int64
+	for _, r := range ranges {
+		size += r.Length
+	}
+	return size
+}
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
+
+// matchETag : reports whether one of entity tags in the header value list matches etag.
+// "*" matches any existing etag.
+func matchETag(list, etag string, strong bool) bool {
+	list = textproto.TrimString(list)
+	if list == "*" {
+		return etag != ""
+	}
+	for list != "" {
+		if list[0] == ',' {
+			list = list[1:]
+			continue
+		}
+		candidate, remain := scanETag(list)
+		if candidate == "" {
+			return false
+		}
+		if strong && etagStrongMatch(candidate, etag) {
+			return true
+		}
+		if !strong && etagWeakMatch(candidate, etag) {
+			return true
+		}
+		list = textproto.TrimString(remain)
+	}
+	return false
+}
+
+// scanETag : determines if a syntactically valid ETag is present at s.
+// if so, the ETag and remaining text after consuming ETag is returned.
+// from net/http package
+func scanETag(s string) (etag string, remain string) {
+	s = textproto.TrimString(s)
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0x21 || c >= 0x23 && c <= 0x7E || c >= 0x80:
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
+
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && a[0] == '"'
+}
+
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/") && b != ""
+}
+
+// readSeekerAt : io.ReaderAt over io.ReadSeeker
+type readSeekerAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (r *readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
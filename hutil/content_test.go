@@ -0,0 +1,89 @@
+package hutil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onlyReadSeeker hides io.ReaderAt of strings.Reader
+type onlyReadSeeker struct {
+	io.ReadSeeker
+}
+
+func TestContent_ServeHTTP(t *testing.T) {
+	modtime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	lastModified := modtime.Format(http.TimeFormat)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	etag := `"v1"`
+
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		wantCode     int
+		wantBody     string
+		wantRange    string
+		wantNoHeader string
+	}{
+		{name: "full", header: nil, wantCode: 200, wantBody: "0123456789"},
+		{name: "range", header: map[string]string{"Range": "bytes=2-4"}, wantCode: 206, wantBody: "234", wantRange: "bytes 2-4/10"},
+		{name: "suffix range", header: map[string]string{"Range": "bytes=-3"}, wantCode: 206, wantBody: "789", wantRange: "bytes 7-9/10"},
+		{name: "not satisfiable", header: map[string]string{"Range": "bytes=10-"}, wantCode: 416, wantRange: "bytes */10"},
+		{name: "zero length suffix", header: map[string]string{"Range": "bytes=-0"}, wantCode: 416, wantRange: "bytes */10"},
+		{name: "invalid range ignored", header: map[string]string{"Range": "bytes=5-2"}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-range etag match", header: map[string]string{"Range": "bytes=0-1", "If-Range": etag}, wantCode: 206, wantBody: "01"},
+		{name: "if-range etag mismatch", header: map[string]string{"Range": "bytes=0-1", "If-Range": `"v0"`}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-range weak etag", header: map[string]string{"Range": "bytes=0-1", "If-Range": `W/"v1"`}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-range date match", header: map[string]string{"Range": "bytes=0-1", "If-Range": lastModified}, wantCode: 206, wantBody: "01"},
+		{name: "if-range date mismatch", header: map[string]string{"Range": "bytes=0-1", "If-Range": before}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-none-match", header: map[string]string{"If-None-Match": `"v0", W/"v1"`}, wantCode: 304, wantNoHeader: "Content-Length"},
+		{name: "if-none-match star", header: map[string]string{"If-None-Match": "*"}, wantCode: 304},
+		{name: "if-none-match mismatch", header: map[string]string{"If-None-Match": `"v0"`}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-none-match put", method: "PUT", header: map[string]string{"If-None-Match": etag}, wantCode: 412},
+		{name: "if-modified-since", header: map[string]string{"If-Modified-Since": lastModified}, wantCode: 304},
+		{name: "if-modified-since old", header: map[string]string{"If-Modified-Since": before}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-none-match precedes if-modified-since", header: map[string]string{"If-None-Match": `"v0"`, "If-Modified-Since": lastModified}, wantCode: 200, wantBody: "0123456789"},
+		{name: "if-match", header: map[string]string{"If-Match": etag, "Range": "bytes=9-"}, wantCode: 206, wantBody: "9"},
+		{name: "if-match mismatch", header: map[string]string{"If-Match": `"v0"`}, wantCode: 412},
+		{name: "if-unmodified-since", header: map[string]string{"If-Unmodified-Since": before}, wantCode: 412},
+		{name: "head", method: "HEAD", header: map[string]string{"Range": "bytes=0-1"}, wantCode: 206, wantBody: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewContent(onlyReadSeeker{strings.NewReader("0123456789")}, "text/plain", modtime, etag)
+			require.Nil(t, err)
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			c.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode == 200 || tt.wantCode == 206 {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+				assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			}
+			if tt.wantRange != "" {
+				assert.Equal(t, tt.wantRange, rec.Header().Get("Content-Range"))
+			}
+			if tt.wantNoHeader != "" {
+				assert.Equal(t, "", rec.Header().Get(tt.wantNoHeader))
+			}
+			assert.Equal(t, etag, rec.Header().Get("Etag"))
+		})
+	}
+}
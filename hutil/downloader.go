@@ -0,0 +1,393 @@
+package hutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// checkpoint is saved after every checkpointInterval bytes of a part are written
+const checkpointInterval = 8 * 1024 * 1024
+
+var errOriginChanged = errors.New("origin content changed")
+
+// Downloader : downloads a file with concurrent Range requests.
+// progress is saved to a checkpoint file(dest + CheckpointSuffix), so that an interrupted download
+// resumes only the missing ranges. If-Range with the ETag(or Last-Modified) of the first response
+// is sent with every request, and the download restarts from zero when the origin content changes.
+type Downloader struct {
+	Client           *HTTPClient
+	Parts            int
+	Header           http.Header // additional request header
+	CheckpointSuffix string
+}
+
+// NewDownloader : parts is the number of byte ranges fetched concurrently
+func NewDownloader(client *HTTPClient, parts int) *Downloader {
+	if parts < 1 {
+		parts = 1
+	}
+	return &Downloader{Client: client, Parts: parts, CheckpointSuffix: ".ckpt"}
+}
+
+// Download : downloads url to dest
+func (d *Downloader) Download(ctx context.Context, url, dest string) error {
+	err := d.download(ctx, url, dest)
+	if err == errOriginChanged {
+		clog.Infof1(dest, "origin content changed, restart download, %s", url)
+		os.Remove(d.checkpointPath(dest))
+		err = d.download(ctx, url, dest)
+	}
+	return err
+}
+
+func (d *Downloader) checkpointPath(dest string) string {
+	return dest + d.CheckpointSuffix
+}
+
+func (d *Downloader) download(ctx context.Context, url, dest string) error {
+	ckptPath := d.checkpointPath(dest)
+	ckpt, err := loadDownloadCheckpoint(ckptPath)
+	if err != nil {
+		clog.Warningf1(dest, "ignore checkpoint, %v", err)
+	}
+	if ckpt != nil && ckpt.URL != url {
+		ckpt = nil
+	}
+
+	// probe the size and the validator with the first byte
+	req, err := d.newRequest(ctx, url, HTTPRange{Start: 0, Length: 1}, ckpt.validator())
+	if err != nil {
+		return err
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request, %v", err)
+	}
+	rresp := (*RangeResponse)(resp)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		resp.Body.Close()
+	case http.StatusOK:
+		if ckpt != nil && ckpt.validator() != "" && resp.Header.Get("Accept-Ranges") == "bytes" {
+			resp.Body.Close()
+			return errOriginChanged
+		}
+		// Range is not supported, download with the response
+		defer resp.Body.Close()
+		os.Remove(ckptPath)
+		return d.downloadWhole(resp, dest)
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		if resp.Header.Get("Content-Range") != "bytes */0" {
+			return fmt.Errorf("unexpected response, %s", resp.Status)
+		}
+		os.Remove(ckptPath)
+		return ioutil.WriteFile(dest, nil, 0644)
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("unexpected response, %s", resp.Status)
+	}
+
+	size, err := rresp.GetContentLength()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("unknown content length, %s", resp.Header.Get("Content-Range"))
+	}
+	if cr := resp.Header.Get("Content-Range"); cr != (HTTPRange{Start: 0, Length: 1}).ContentRange(size) {
+		return fmt.Errorf("unexpected Content-Range, %s", cr)
+	}
+
+	etag := resp.Header.Get("Etag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if ckpt != nil && (ckpt.Size != size || ckpt.ETag != etag || ckpt.LastModified != lastModified) {
+		clog.Infof1(dest, "checkpoint is out of date, restart download, %s", url)
+		ckpt = nil
+	}
+
+	flag := os.O_RDWR | os.O_CREATE
+	if ckpt == nil {
+		ckpt = newDownloadCheckpoint(url, etag, lastModified, size, d.Parts)
+		flag |= os.O_TRUNC
+	} else {
+		clog.Infof1(dest, "resume download, %d/%d bytes, %s", ckpt.written(), size, url)
+	}
+
+	f, err := os.OpenFile(dest, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file, %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate file, %v", err)
+	}
+
+	job := &downloadJob{ckpt: ckpt, path: ckptPath, f: f}
+	if err := job.save(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ckpt.Parts))
+	for i := range ckpt.Parts {
+		if ckpt.Parts[i].done() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := d.fetchPart(ctx, f, job, i); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := job.save(); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err == errOriginChanged {
+			return err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file, %v", err)
+	}
+	os.Remove(ckptPath)
+	return nil
+}
+
+func (d *Downloader) fetchPart(ctx context.Context, f *os.File, job *downloadJob, i int) error {
+	p := job.part(i)
+	r := HTTPRange{Start: p.Start + p.Written, Length: p.Length - p.Written}
+
+	req, err := d.newRequest(ctx, job.ckpt.URL, r, job.ckpt.validator())
+	if err != nil {
+		return err
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request range(%s), %v", r.ContentRange(job.ckpt.Size), err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if job.ckpt.validator() != "" {
+			return errOriginChanged
+		}
+		return fmt.Errorf("range is not supported, %s", resp.Status)
+	default:
+		return fmt.Errorf("unexpected response of range(%s), %s", r.ContentRange(job.ckpt.Size), resp.Status)
+	}
+	if cr := resp.Header.Get("Content-Range"); cr != r.ContentRange(job.ckpt.Size) {
+		return fmt.Errorf("content-range mismatch, requested(%s), responded(%s)", r.ContentRange(job.ckpt.Size), cr)
+	}
+
+	buf := make([]byte, 32*1024)
+	offset := r.Start
+	remain := r.Length
+	unsaved := int64(0)
+	for remain > 0 {
+		if int64(len(buf)) > remain {
+			buf = buf[:remain]
+		}
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := f.WriteAt(buf[:n], offset); err != nil {
+				return fmt.Errorf("failed to write file, %v", err)
+			}
+			offset += int64(n)
+			remain -= int64(n)
+			unsaved += int64(n)
+			job.advance(i, int64(n))
+			if unsaved >= checkpointInterval {
+				if err := job.save(); err != nil {
+					return err
+				}
+				unsaved = 0
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return fmt.Errorf("failed to read range(%s), %v", r.ContentRange(job.ckpt.Size), rerr)
+		}
+	}
+	if remain > 0 {
+		return fmt.Errorf("failed to read range(%s), %v", r.ContentRange(job.ckpt.Size), io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+func (d *Downloader) newRequest(ctx context.Context, url string, r HTTPRange, ifRange string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vv := range d.Header {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.Start, r.Start+r.Length-1))
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+	return req, nil
+}
+
+func (d *Downloader) downloadWhole(resp *http.Response, dest string) error {
+	f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file, %v", err)
+	}
+	defer f.Close()
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download, %v", err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("failed to download, %v", io.ErrUnexpectedEOF)
+	}
+	return f.Sync()
+}
+
+type downloadPart struct {
+	Start   int64 `json:"start"`
+	Length  int64 `json:"length"`
+	Written int64 `json:"written"`
+}
+
+func (p downloadPart) done() bool {
+	return p.Written >= p.Length
+}
+
+type downloadCheckpoint struct {
+	URL          string         `json:"url"`
+	ETag         string         `json:"etag"`
+	LastModified string         `json:"lastModified"`
+	Size         int64          `json:"size"`
+	Parts        []downloadPart `json:"parts"`
+}
+
+func newDownloadCheckpoint(url, etag, lastModified string, size int64, parts int) *downloadCheckpoint {
+	c := &downloadCheckpoint{URL: url, ETag: etag, LastModified: lastModified, Size: size}
+	if int64(parts) > size {
+		parts = int(size)
+	}
+	if parts < 1 {
+		parts = 1
+	}
+	partSize := size / int64(parts)
+	for i := 0; i < parts; i++ {
+		p := downloadPart{Start: int64(i) * partSize, Length: partSize}
+		if i == parts-1 {
+			p.Length = size - p.Start
+		}
+		c.Parts = append(c.Parts, p)
+	}
+	return c
+}
+
+func loadDownloadCheckpoint(path string) (*downloadCheckpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint [%v], %v", path, err)
+	}
+	c := &downloadCheckpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint [%v], %v", path, err)
+	}
+	return c, nil
+}
+
+// validator : value of If-Range header, strong ETag or Last-Modified
+func (c *downloadCheckpoint) validator() string {
+	if c == nil {
+		return ""
+	}
+	if c.ETag != "" && !strings.HasPrefix(c.ETag, "W/") {
+		return c.ETag
+	}
+	return c.LastModified
+}
+
+func (c *downloadCheckpoint) written() int64 {
+	var n int64
+	for _, p := range c.Parts {
+		n += p.Written
+	}
+	return n
+}
+
+type downloadJob struct {
+	mu   sync.Mutex
+	ckpt *downloadCheckpoint
+	path string
+	f    *os.File // synced before the checkpoint is saved
+}
+
+func (j *downloadJob) part(i int) downloadPart {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.ckpt.Parts[i]
+}
+
+func (j *downloadJob) advance(i int, n int64) {
+	j.mu.Lock()
+	j.ckpt.Parts[i].Written += n
+	j.mu.Unlock()
+}
+
+// save : the checkpoint records only bytes already synced to the file.
+// the file is synced under the lock that advance takes, so Written can't grow between the sync and the checkpoint.
+func (j *downloadJob) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f != nil {
+		if err := j.f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file, %v", err)
+		}
+	}
+	b, err := json.Marshal(j.ckpt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint, %v", err)
+	}
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint [%v], %v", tmp, err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to rename checkpoint [%v], %v", j.path, err)
+	}
+	return nil
+}
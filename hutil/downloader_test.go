@@ -0,0 +1,132 @@
+package hutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rangeOrigin struct {
+	mu      sync.Mutex
+	content []byte
+	etag    string
+	ranges  []string
+}
+
+func (o *rangeOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	o.ranges = append(o.ranges, r.Header.Get("Range"))
+	content, etag := o.content, o.etag
+	o.mu.Unlock()
+	w.Header().Set("Etag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+func (o *rangeOrigin) requestedRanges() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.ranges...)
+}
+
+func testContent(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestDownloader_Download(t *testing.T) {
+	origin := &rangeOrigin{content: testContent(100000), etag: `"v1"`}
+	ts := httptest.NewServer(origin)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	d := NewDownloader(NewHTTPClient(5*time.Second, nil, nil), 4)
+	require.Nil(t, d.Download(context.Background(), ts.URL, dest))
+
+	b, err := ioutil.ReadFile(dest)
+	require.Nil(t, err)
+	assert.Equal(t, origin.content, b)
+	assert.ElementsMatch(t, []string{
+		"bytes=0-0", "bytes=0-24999", "bytes=25000-49999", "bytes=50000-74999", "bytes=75000-99999",
+	}, origin.requestedRanges())
+
+	_, err = os.Stat(dest + ".ckpt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloader_Resume(t *testing.T) {
+	origin := &rangeOrigin{content: testContent(1000), etag: `"v1"`}
+	ts := httptest.NewServer(origin)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	partial := make([]byte, 1000)
+	copy(partial, origin.content[:600])
+	require.Nil(t, ioutil.WriteFile(dest, partial, 0644))
+
+	ckpt := newDownloadCheckpoint(ts.URL, `"v1"`, "", 1000, 4)
+	ckpt.Parts[0].Written = 250
+	ckpt.Parts[1].Written = 250
+	ckpt.Parts[2].Written = 100
+	b, _ := json.Marshal(ckpt)
+	require.Nil(t, ioutil.WriteFile(dest+".ckpt", b, 0644))
+
+	d := NewDownloader(NewHTTPClient(5*time.Second, nil, nil), 4)
+	require.Nil(t, d.Download(context.Background(), ts.URL, dest))
+
+	b, err := ioutil.ReadFile(dest)
+	require.Nil(t, err)
+	assert.Equal(t, origin.content, b)
+	assert.ElementsMatch(t, []string{"bytes=0-0", "bytes=600-749", "bytes=750-999"}, origin.requestedRanges())
+}
+
+func TestDownloader_OriginChanged(t *testing.T) {
+	origin := &rangeOrigin{content: testContent(1000), etag: `"v2"`}
+	ts := httptest.NewServer(origin)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	require.Nil(t, ioutil.WriteFile(dest, make([]byte, 1000), 0644))
+
+	ckpt := newDownloadCheckpoint(ts.URL, `"v1"`, "", 1000, 2)
+	ckpt.Parts[0].Written = 500
+	b, _ := json.Marshal(ckpt)
+	require.Nil(t, ioutil.WriteFile(dest+".ckpt", b, 0644))
+
+	d := NewDownloader(NewHTTPClient(5*time.Second, nil, nil), 2)
+	require.Nil(t, d.Download(context.Background(), ts.URL, dest))
+
+	b, err := ioutil.ReadFile(dest)
+	require.Nil(t, err)
+	assert.Equal(t, origin.content, b)
+	assert.ElementsMatch(t, []string{"bytes=0-0", "bytes=0-0", "bytes=0-499", "bytes=500-999"}, origin.requestedRanges())
+}
+
+func TestDownloader_RangeNotSupported(t *testing.T) {
+	content := testContent(1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	d := NewDownloader(NewHTTPClient(5*time.Second, nil, nil), 4)
+	require.Nil(t, d.Download(context.Background(), ts.URL, dest))
+
+	b, err := ioutil.ReadFile(dest)
+	require.Nil(t, err)
+	assert.Equal(t, content, b)
+}
@@ -0,0 +1,104 @@
+package hutil
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/castisdev/gcommon/clog"
+	"github.com/castisdev/gcommon/consistenthash"
+)
+
+// FailoverClient : sends a request to the origins in the preference order of
+// consistenthash.Map.GetItems(key), trying the next origin on connection errors or 5xx responses.
+// origins of the map are host[:port] strings, which replace the host of the request URL.
+type FailoverClient struct {
+	Client  *HTTPClient
+	Origins *consistenthash.Map
+}
+
+// SkippedOrigin :
+type SkippedOrigin struct {
+	Origin string
+	Err    error
+}
+
+// FailoverResponse :
+type FailoverResponse struct {
+	*http.Response
+	Origin  string          // origin which served the response
+	Skipped []SkippedOrigin // origins tried and failed before Origin
+}
+
+// NewFailoverClient :
+func NewFailoverClient(client *HTTPClient, origins *consistenthash.Map) *FailoverClient {
+	return &FailoverClient{Client: client, Origins: origins}
+}
+
+// Do : if every origin responds 5xx, the last response is returned
+func (f *FailoverClient) Do(req *http.Request, key string) (*FailoverResponse, error) {
+	origins := f.Origins.GetItems(key)
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("no origin for key(%s)", key)
+	}
+
+	var skipped []SkippedOrigin
+	for i, origin := range origins {
+		outReq := req.Clone(req.Context())
+		outReq.URL.Host = origin
+		outReq.Host = ""
+		if i > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind body, %v", err)
+			}
+			outReq.Body = body
+		}
+
+		res, err := f.Client.Do(outReq)
+		if err == nil && res.StatusCode < 500 {
+			return &FailoverResponse{Response: res, Origin: origin, Skipped: skipped}, nil
+		}
+
+		last := i == len(origins)-1 || !canRewindBody(req) || req.Context().Err() != nil
+		if last {
+			if err != nil {
+				skipped = append(skipped, SkippedOrigin{Origin: origin, Err: err})
+				return nil, &FailoverError{Key: key, Skipped: skipped}
+			}
+			return &FailoverResponse{Response: res, Origin: origin, Skipped: skipped}, nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf("response %s", res.Status)
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+		skipped = append(skipped, SkippedOrigin{Origin: origin, Err: err})
+		clog.Warningf1(requestTraceID(req), "origin %s failed, try %s, %s %s, %v",
+			origin, origins[i+1], req.Method, req.URL.Path, err)
+	}
+	// not reached
+	return nil, &FailoverError{Key: key, Skipped: skipped}
+}
+
+// FailoverError : every origin failed
+type FailoverError struct {
+	Key     string
+	Skipped []SkippedOrigin
+}
+
+// Error :
+func (e *FailoverError) Error() string {
+	msgs := make([]string, len(e.Skipped))
+	for i, s := range e.Skipped {
+		msgs[i] = fmt.Sprintf("%s: %v", s.Origin, s.Err)
+	}
+	return fmt.Sprintf("all origins failed for key(%s), %s", e.Key, strings.Join(msgs, ", "))
+}
+
+func canRewindBody(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
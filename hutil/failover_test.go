@@ -0,0 +1,84 @@
+package hutil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castisdev/gcommon/consistenthash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFailoverTestOrigins(t *testing.T, behaviors ...string) (*consistenthash.Map, []string) {
+	byHost := make(map[string]string)
+	keys := make(map[string]int)
+	for range behaviors {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch byHost[r.Host] {
+			case "close":
+				hj, _ := w.(http.Hijacker)
+				conn, _, _ := hj.Hijack()
+				conn.Close()
+			case "503":
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.Write([]byte(r.Host))
+			}
+		}))
+		t.Cleanup(ts.Close)
+		host := strings.TrimPrefix(ts.URL, "http://")
+		keys[host] = 1
+	}
+
+	m := consistenthash.New(10, nil)
+	m.Add(keys)
+	order := m.GetItems("content")
+	for i, host := range order {
+		byHost[host] = behaviors[i]
+	}
+	return m, order
+}
+
+func TestFailoverClient_Do(t *testing.T) {
+	m, order := newFailoverTestOrigins(t, "close", "503", "ok")
+
+	cl := NewFailoverClient(NewHTTPClient(5*time.Second, nil, nil), m)
+	req, _ := http.NewRequest("GET", "http://placeholder/content", nil)
+	resp, err := cl.Do(req, "content")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, order[2], resp.Origin)
+	require.Equal(t, 2, len(resp.Skipped))
+	assert.Equal(t, order[0], resp.Skipped[0].Origin)
+	assert.Equal(t, order[1], resp.Skipped[1].Origin)
+}
+
+func TestFailoverClient_DoHappyPath(t *testing.T) {
+	m, order := newFailoverTestOrigins(t, "ok", "503", "close")
+
+	cl := NewFailoverClient(NewHTTPClient(5*time.Second, nil, nil), m)
+	req, _ := http.NewRequest("GET", "http://placeholder/content", nil)
+	resp, err := cl.Do(req, "content")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, order[0], resp.Origin)
+	assert.Equal(t, 0, len(resp.Skipped))
+}
+
+func TestFailoverClient_DoAllFailed(t *testing.T) {
+	m, _ := newFailoverTestOrigins(t, "503", "close")
+
+	cl := NewFailoverClient(NewHTTPClient(5*time.Second, nil, nil), m)
+	req, _ := http.NewRequest("GET", "http://placeholder/content", nil)
+	_, err := cl.Do(req, "content")
+	var fe *FailoverError
+	require.True(t, errors.As(err, &fe))
+	assert.Equal(t, 2, len(fe.Skipped))
+}
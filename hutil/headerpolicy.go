@@ -0,0 +1,125 @@
+package hutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HeaderPolicy : header filtering policy, applied in the order of
+// hop-by-hop stripping, Allow, Deny, Rename and Override.
+// names of Allow and Deny are case-insensitive and may end with "*" to match a prefix(e.g. "X-Internal-*").
+type HeaderPolicy struct {
+	StripHopByHop bool              `yaml:"strip_hop_by_hop"` // RFC 7230 hop-by-hop headers and headers named in Connection
+	Allow         []string          `yaml:"allow"`            // if not empty, only these headers pass
+	Deny          []string          `yaml:"deny"`
+	Rename        map[string]string `yaml:"rename"`   // from: to
+	Override      map[string]string `yaml:"override"` // sets the value, empty value removes the header
+}
+
+// HeaderPolicies : policies of origin requests and client responses
+type HeaderPolicies struct {
+	Request  *HeaderPolicy `yaml:"request"`
+	Response *HeaderPolicy `yaml:"response"`
+}
+
+// DefaultHeaderPolicy : strips hop-by-hop headers only
+func DefaultHeaderPolicy() *HeaderPolicy {
+	return &HeaderPolicy{StripHopByHop: true}
+}
+
+var defaultHeaderPolicy = DefaultHeaderPolicy()
+
+// LoadHeaderPolicies : loads yaml file, e.g.
+//
+//	request:
+//	  strip_hop_by_hop: true
+//	  deny: [Authorization, Cookie, X-Internal-*]
+//	  rename: {X-Client-Token: X-Origin-Token}
+//	response:
+//	  strip_hop_by_hop: true
+//	  override: {Server: ""}
+func LoadHeaderPolicies(path string) (*HeaderPolicies, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header policy [%v], %v", path, err)
+	}
+	var p HeaderPolicies
+	if err := yaml.UnmarshalStrict(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse header policy [%v], %v", path, err)
+	}
+	return &p, nil
+}
+
+// Apply : applies the policy to h in place
+func (p *HeaderPolicy) Apply(h http.Header) {
+	if p == nil {
+		return
+	}
+	if p.StripHopByHop {
+		removeHopByHopHeaders(h)
+	}
+	if len(p.Allow) > 0 {
+		for k := range h {
+			if !matchHeaderName(p.Allow, k) {
+				delete(h, k)
+			}
+		}
+	}
+	if len(p.Deny) > 0 {
+		for k := range h {
+			if matchHeaderName(p.Deny, k) {
+				delete(h, k)
+			}
+		}
+	}
+	for from, to := range p.Rename {
+		if vv := h.Values(from); len(vv) > 0 {
+			h.Del(from)
+			h[http.CanonicalHeaderKey(to)] = vv
+		}
+	}
+	for k, v := range p.Override {
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+	}
+}
+
+func matchHeaderName(names []string, key string) bool {
+	for _, n := range names {
+		if strings.HasSuffix(n, "*") {
+			prefix := n[:len(n)-1]
+			if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(n, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOriginRequestHeaderWithPolicy : like SetOriginRequestHeader, the client request header is filtered by p.
+// nil p does not filter any header.
+func SetOriginRequestHeaderWithPolicy(originReqHeader *http.Header, clientReqHeader http.Header, p *HeaderPolicy) {
+	h := clientReqHeader
+	if p != nil {
+		h = clientReqHeader.Clone()
+		p.Apply(h)
+	}
+	for k, vv := range h {
+		if k == "Host" || k == "Range" || k == "Connection" {
+			continue
+		}
+		originReqHeader.Del(k)
+		for _, v := range vv {
+			originReqHeader.Add(k, v)
+		}
+	}
+}
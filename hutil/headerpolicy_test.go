@@ -0,0 +1,94 @@
+package hutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderPolicy_Apply(t *testing.T) {
+	p := &HeaderPolicy{
+		StripHopByHop: true,
+		Deny:          []string{"authorization", "X-Internal-*"},
+		Rename:        map[string]string{"X-Client-Token": "X-Origin-Token"},
+		Override:      map[string]string{"User-Agent": "edge", "Cookie": ""},
+	}
+
+	h := http.Header{}
+	h.Set("Connection", "X-Hop")
+	h.Set("X-Hop", "1")
+	h.Set("Proxy-Authorization", "secret")
+	h.Set("Authorization", "secret")
+	h.Set("X-Internal-Id", "1")
+	h.Set("X-Client-Token", "token")
+	h.Set("User-Agent", "player")
+	h.Set("Cookie", "a=b")
+	h.Set("Accept", "*/*")
+
+	p.Apply(h)
+	assert.Equal(t, http.Header{
+		"X-Origin-Token": {"token"},
+		"User-Agent":     {"edge"},
+		"Accept":         {"*/*"},
+	}, h)
+}
+
+func TestHeaderPolicy_ApplyAllow(t *testing.T) {
+	p := &HeaderPolicy{Allow: []string{"Accept*", "Range"}}
+
+	h := http.Header{}
+	h.Set("Accept", "*/*")
+	h.Set("Accept-Encoding", "gzip")
+	h.Set("Range", "bytes=0-")
+	h.Set("Authorization", "secret")
+
+	p.Apply(h)
+	assert.Equal(t, http.Header{
+		"Accept":          {"*/*"},
+		"Accept-Encoding": {"gzip"},
+		"Range":           {"bytes=0-"},
+	}, h)
+}
+
+func TestLoadHeaderPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`
+request:
+  strip_hop_by_hop: true
+  deny: [Authorization, Cookie]
+  rename:
+    X-Client-Token: X-Origin-Token
+response:
+  override:
+    Server: ""
+`), 0644))
+
+	p, err := LoadHeaderPolicies(path)
+	require.Nil(t, err)
+	require.NotNil(t, p.Request)
+	require.NotNil(t, p.Response)
+	assert.True(t, p.Request.StripHopByHop)
+	assert.Equal(t, []string{"Authorization", "Cookie"}, p.Request.Deny)
+	assert.Equal(t, "X-Origin-Token", p.Request.Rename["X-Client-Token"])
+	assert.Equal(t, map[string]string{"Server": ""}, p.Response.Override)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("request:\n  unknown: 1\n"), 0644))
+	_, err = LoadHeaderPolicies(path)
+	assert.NotNil(t, err)
+}
+
+func TestSetOriginRequestHeaderWithPolicy(t *testing.T) {
+	origin := http.Header{}
+	client := http.Header{}
+	client.Set("Authorization", "secret")
+	client.Set("Accept", "*/*")
+	client.Set("Range", "bytes=0-")
+
+	SetOriginRequestHeaderWithPolicy(&origin, client, &HeaderPolicy{Deny: []string{"Authorization"}})
+	assert.Equal(t, http.Header{"Accept": {"*/*"}}, origin)
+	assert.Equal(t, "secret", client.Get("Authorization"))
+}
@@ -10,9 +10,10 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/castisdev/gcommon/clog"
@@ -136,28 +137,100 @@ func ParseRange(s string, size int64) ([]HTTPRange, error) {
 	return ranges, nil
 }
 
-// SetOriginRequestHeader :
+// SetOriginRequestHeader : copies client request headers except Host, Range and hop-by-hop headers
 func SetOriginRequestHeader(originReqHeader *http.Header, clientReqHeader http.Header) {
-	for k, vv := range clientReqHeader {
-		if k == "Host" || k == "Range" || k == "Connection" {
-			continue
-		}
-		originReqHeader.Del(k)
-		for _, v := range vv {
-			originReqHeader.Add(k, v)
-		}
-	}
+	SetOriginRequestHeaderWithPolicy(originReqHeader, clientReqHeader, defaultHeaderPolicy)
 }
 
+// AccelLimitRateHeader : response header setting the per-response rate(bytes per second) like nginx.
+// it is removed from the response, "0" or "off" disables the per-response rate.
+const AccelLimitRateHeader = "X-Accel-Limit-Rate"
+
 // RateLimitResponseWriter :
 type RateLimitResponseWriter struct {
-	respWriter http.ResponseWriter
-	bucket     *ratelimit.Bucket
+	respWriter  http.ResponseWriter
+	limiters    []RateLimiter     // shared limiters
+	limit       *AdjustableBucket // per-response limiter
+	all         []RateLimiter     // limiters + limit
+	limitAfter  int64             // bytes written without limit
+	written     int64
+	wroteHeader bool
 }
 
-// NewRateLimitResponseWriter : if bucket is nil, no limit
+// NewRateLimitResponseWriter : if bucket is nil, no limit.
+// the result is not *RateLimitResponseWriter but a wrapper of it, use AsRateLimitResponseWriter to get it.
 func NewRateLimitResponseWriter(w http.ResponseWriter, bucket *ratelimit.Bucket) http.ResponseWriter {
-	return &RateLimitResponseWriter{respWriter: w, bucket: bucket}
+	return NewMultiRateLimitResponseWriter(w, bucket)
+}
+
+// NewMultiRateLimitResponseWriter : writes only when all buckets allow,
+// e.g. server-wide, per-virtual-host, per-client-IP and per-response buckets. nil buckets are ignored.
+// the result is a wrapper of *RateLimitResponseWriter(see AsRateLimitResponseWriter).
+func NewMultiRateLimitResponseWriter(w http.ResponseWriter, buckets ...*ratelimit.Bucket) http.ResponseWriter {
+	return NewRateLimitAfterResponseWriter(w, 0, buckets...)
+}
+
+// NewRateLimitAfterResponseWriter : like nginx limit_rate_after,
+// the first limitAfter bytes(e.g. nginxtype.Int64Size of config) are written without limit.
+// the result is a wrapper of *RateLimitResponseWriter(see AsRateLimitResponseWriter).
+func NewRateLimitAfterResponseWriter(w http.ResponseWriter, limitAfter int64, buckets ...*ratelimit.Bucket) http.ResponseWriter {
+	limiters := make([]RateLimiter, len(buckets))
+	for i, b := range buckets {
+		limiters[i] = b
+	}
+	return NewRateLimiterResponseWriter(w, limitAfter, limiters...)
+}
+
+// NewRateLimiterResponseWriter : like NewRateLimitAfterResponseWriter, with RateLimiter(e.g. AdjustableBucket)
+func NewRateLimiterResponseWriter(w http.ResponseWriter, limitAfter int64, limiters ...RateLimiter) http.ResponseWriter {
+	r := &RateLimitResponseWriter{respWriter: w, limitAfter: limitAfter}
+	for _, l := range limiters {
+		if !isNilRateLimiter(l) {
+			r.limiters = append(r.limiters, l)
+		}
+	}
+	r.all = r.limiters
+	return WrapResponseWriter(r, w)
+}
+
+// SetLimitRate : sets the per-response rate in bytes per second, 0 removes the per-response limit.
+// it's applied with the shared limiters.
+func (r *RateLimitResponseWriter) SetLimitRate(rate int64) {
+	if rate <= 0 {
+		r.limit = nil
+		r.all = r.limiters
+		return
+	}
+	capacity := rate / 10
+	if r.limit != nil {
+		r.limit.SetRate(float64(rate), capacity)
+		return
+	}
+	r.limit = NewAdjustableBucket(float64(rate), capacity)
+	r.all = append(r.limiters[:len(r.limiters):len(r.limiters)], r.limit)
+}
+
+// SetResponseLimitRate : sets the per-response rate of w, if w is(or wraps) a RateLimitResponseWriter
+func SetResponseLimitRate(w http.ResponseWriter, rate int64) bool {
+	r, ok := AsRateLimitResponseWriter(w)
+	if ok {
+		r.SetLimitRate(rate)
+	}
+	return ok
+}
+
+// AsRateLimitResponseWriter : RateLimitResponseWriter which w is or wraps, e.g. the result of NewRateLimitResponseWriter
+func AsRateLimitResponseWriter(w http.ResponseWriter) (*RateLimitResponseWriter, bool) {
+	for {
+		switch t := w.(type) {
+		case *RateLimitResponseWriter:
+			return t, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil, false
+		}
+	}
 }
 
 // Header :
@@ -167,34 +240,69 @@ func (r *RateLimitResponseWriter) Header() http.Header {
 
 // WriteHeader :
 func (r *RateLimitResponseWriter) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		h := r.respWriter.Header()
+		if v := h.Get(AccelLimitRateHeader); v != "" {
+			h.Del(AccelLimitRateHeader)
+			if v == "off" {
+				v = "0"
+			}
+			if rate, err := strconv.ParseInt(v, 10, 64); err == nil && rate >= 0 {
+				r.SetLimitRate(rate)
+			} else {
+				clog.Warningf("invalid %s header, %s", AccelLimitRateHeader, v)
+			}
+		}
+	}
 	r.respWriter.WriteHeader(code)
 }
 
 // Write :
 func (r *RateLimitResponseWriter) Write(b []byte) (int, error) {
-	if r.bucket != nil {
-		nwrited := 0
-		unit := int(r.bucket.Capacity())
-		w := ratelimit.Writer(r.respWriter, r.bucket)
-		for i := 0; i <= len(b)/unit; i++ {
-			s := i * unit
-			if s >= len(b) {
-				break
-			}
-			e := s + unit
-			if e > len(b) {
-				e = len(b)
-			}
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
 
-			n, err := w.Write(b[s:e])
-			if err != nil {
-				return nwrited, err
-			}
-			nwrited += n
+	nwrited := 0
+	if r.written < r.limitAfter {
+		e := len(b)
+		if remain := r.limitAfter - r.written; int64(e) > remain {
+			e = int(remain)
+		}
+		n, err := r.respWriter.Write(b[:e])
+		nwrited += n
+		r.written += int64(n)
+		if err != nil {
+			return nwrited, err
 		}
-		return nwrited, nil
+		b = b[e:]
 	}
-	return r.respWriter.Write(b)
+
+	if len(r.all) == 0 {
+		n, err := r.respWriter.Write(b)
+		r.written += int64(n)
+		return nwrited + n, err
+	}
+
+	for s := 0; s < len(b); {
+		e := s + limitersUnit(r.all)
+		if e > len(b) {
+			e = len(b)
+		}
+		if d := takeLimiters(r.all, int64(e-s)); d > 0 {
+			time.Sleep(d)
+		}
+
+		n, err := r.respWriter.Write(b[s:e])
+		nwrited += n
+		r.written += int64(n)
+		if err != nil {
+			return nwrited, err
+		}
+		s = e
+	}
+	return nwrited, nil
 }
 
 // Flush :
@@ -212,17 +320,127 @@ func (r *RateLimitResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error)
 	return nil, nil, fmt.Errorf("doesn't support hijacking")
 }
 
-// LogResponseWriter :
+// ReadFrom : writes src by ReadFrom of the inner writer(e.g. sendfile of http server) in chunks,
+// waiting for the limiters between the chunks
+func (r *RateLimitResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	rf, ok := r.respWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{r}, src)
+	}
+
+	var nwrited int64
+	if r.written < r.limitAfter {
+		n, eof, err := readFromChunk(rf, src, r.limitAfter-r.written)
+		nwrited += n
+		r.written += n
+		if err != nil || eof {
+			return nwrited, err
+		}
+	}
+
+	for {
+		unit := int64(-1)
+		if len(r.all) > 0 {
+			unit = int64(limitersUnit(r.all))
+		}
+		n, eof, err := readFromChunk(rf, src, unit)
+		nwrited += n
+		r.written += n
+		if n > 0 && len(r.all) > 0 {
+			if d := takeLimiters(r.all, n); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		if err != nil || eof {
+			return nwrited, err
+		}
+	}
+}
+
+// Push :
+func (r *RateLimitResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.respWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap :
+func (r *RateLimitResponseWriter) Unwrap() http.ResponseWriter {
+	return r.respWriter
+}
+
+// readFromChunk : writes up to n bytes of src(all if n < 0) by rf, and reports whether src reached EOF.
+// *io.LimitedReader src is unwrapped, so the chunk is still a limited *os.File for sendfile.
+func readFromChunk(rf io.ReaderFrom, src io.Reader, n int64) (int64, bool, error) {
+	lr, limited := src.(*io.LimitedReader)
+	if limited {
+		if lr.N <= 0 {
+			return 0, true, nil
+		}
+		if n < 0 || n > lr.N {
+			n = lr.N
+		}
+		src = lr.R
+	}
+	if n < 0 {
+		written, err := rf.ReadFrom(src)
+		return written, true, err
+	}
+	written, err := rf.ReadFrom(&io.LimitedReader{R: src, N: n})
+	if limited {
+		lr.N -= written
+		return written, written < n || lr.N <= 0, err
+	}
+	return written, written < n, err
+}
+
+// LogResponseWriter : logs non-2xx responses, and records status, bytes and times of the response for access logs
 type LogResponseWriter struct {
 	respWriter http.ResponseWriter
 	reqID      string
 	originKey  string
 	req        *http.Request
+
+	reqBody     *countingReadCloser
+	start       time.Time
+	firstByte   time.Time
+	status      int
+	written     int64
+	wroteHeader bool
+	quiet       bool // records only, no log
 }
 
-// NewLogResponseWriter :
+// NewLogResponseWriter : request body of req is counted for RequestBytes.
+// the result is not *LogResponseWriter but a wrapper of it, use AsLogResponseWriter to get it.
 func NewLogResponseWriter(w http.ResponseWriter, reqID, originKey string, req *http.Request) http.ResponseWriter {
-	return &LogResponseWriter{respWriter: w, reqID: reqID, originKey: originKey, req: req}
+	return WrapResponseWriter(newLogResponseWriter(w, reqID, originKey, req), w)
+}
+
+// AsLogResponseWriter : LogResponseWriter which w is or wraps, e.g. the result of NewLogResponseWriter
+func AsLogResponseWriter(w http.ResponseWriter) (*LogResponseWriter, bool) {
+	for {
+		switch t := w.(type) {
+		case *LogResponseWriter:
+			return t, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+func newLogResponseWriter(w http.ResponseWriter, reqID, originKey string, req *http.Request) *LogResponseWriter {
+	lw := &LogResponseWriter{respWriter: w, reqID: reqID, originKey: originKey, req: req, start: time.Now()}
+	if req.Body != nil && req.Body != http.NoBody {
+		lw.reqBody = &countingReadCloser{ReadCloser: req.Body}
+		req.Body = lw.reqBody
+	}
+	return lw
 }
 
 // Header :
@@ -233,7 +451,13 @@ func (w *LogResponseWriter) Header() http.Header {
 // WriteHeader :
 func (w *LogResponseWriter) WriteHeader(code int) {
 	w.respWriter.WriteHeader(code)
-	if code == 200 || code == 206 {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.firstByte = time.Now()
+	if w.quiet || code == 200 || code == 206 {
 		// no log
 		return
 	}
@@ -253,7 +477,46 @@ func (w *LogResponseWriter) WriteHeader(code int) {
 
 // Write :
 func (w *LogResponseWriter) Write(b []byte) (int, error) {
-	return w.respWriter.Write(b)
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.respWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Status : response status code, 200 if nothing is written yet
+func (w *LogResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// BytesWritten : response body bytes
+func (w *LogResponseWriter) BytesWritten() int64 {
+	return w.written
+}
+
+// RequestBytes : request body bytes read
+func (w *LogResponseWriter) RequestBytes() int64 {
+	if w.reqBody == nil {
+		return 0
+	}
+	return w.reqBody.n
+}
+
+// TimeToFirstByte : time from the start of the request to the response header, 0 if not written yet
+func (w *LogResponseWriter) TimeToFirstByte() time.Duration {
+	if w.firstByte.IsZero() {
+		return 0
+	}
+	return w.firstByte.Sub(w.start)
+}
+
+// Duration : time from the start of the request
+func (w *LogResponseWriter) Duration() time.Duration {
+	return time.Since(w.start)
 }
 
 // Flush :
@@ -271,10 +534,40 @@ func (w *LogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("doesn't support hijacking")
 }
 
+// ReadFrom : uses ReadFrom of the inner writer(e.g. sendfile of http server) if supported
+func (w *LogResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	rf, ok := w.respWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{w}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	w.written += n
+	return n, err
+}
+
+// Push :
+func (w *LogResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.respWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap :
+func (w *LogResponseWriter) Unwrap() http.ResponseWriter {
+	return w.respWriter
+}
+
 // HTTPClient :
 type HTTPClient struct {
 	*http.Client
 	FollowRedirect bool
+	RetryPolicy    *RetryPolicy    // nil: no retry
+	Breaker        *CircuitBreaker // nil: no circuit breaker
+	metrics        *clientMetrics
 }
 
 const redirectErrorStr = "redirect response"
@@ -303,21 +596,71 @@ func NewHTTPOverUdsClientWithoutRedirect(timeout time.Duration, sockFile string)
 	return newClientWithUds(timeout, autoRedirect, sockFile)
 }
 
-func newClient(timeout time.Duration, autoRedirect bool, localAddr net.Addr, tlsConfig *tls.Config) *HTTPClient {
+// HTTPClientOptions :
+type HTTPClientOptions struct {
+	Timeout        time.Duration // 0: no timeout
+	FollowRedirect bool
+	LocalAddr      net.Addr
+	TLSConfig      *tls.Config
+	SockFile       string // connects to the unix domain socket if not empty
+
+	KeepAlive             bool // reuses connections if true
+	MaxIdleConns          int  // 0: no limit
+	MaxIdleConnsPerHost   int  // 0: http.DefaultMaxIdleConnsPerHost
+	IdleConnTimeout       time.Duration
+	ResponseHeaderTimeout time.Duration
+	DialTimeout           time.Duration
+	TCPKeepAlive          time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ExpectContinueTimeout time.Duration
+	Proxy                 func(*http.Request) (*url.URL, error) // nil: no proxy
+	EnableHTTP2           bool
+}
+
+// DefaultHTTPClientOptions : options of NewHTTPClient
+func DefaultHTTPClientOptions() HTTPClientOptions {
+	return HTTPClientOptions{
+		FollowRedirect:        true,
+		KeepAlive:             false,
+		IdleConnTimeout:       90 * time.Second,
+		DialTimeout:           30 * time.Second,
+		TCPKeepAlive:          30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		Proxy:                 http.ProxyFromEnvironment,
+	}
+}
+
+// NewHTTPClientWithOptions :
+func NewHTTPClientWithOptions(opts HTTPClientOptions) *HTTPClient {
+	t := &http.Transport{
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ExpectContinueTimeout: opts.ExpectContinueTimeout,
+		DisableKeepAlives:     !opts.KeepAlive,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		TLSClientConfig:       opts.TLSConfig,
+		ForceAttemptHTTP2:     opts.EnableHTTP2,
+	}
+	if opts.SockFile != "" {
+		sockFile := opts.SockFile
+		d := &net.Dialer{Timeout: opts.DialTimeout}
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", sockFile)
+		}
+	} else {
+		t.Proxy = opts.Proxy
+		t.DialContext = dialer(opts.LocalAddr, opts.DialTimeout, opts.TCPKeepAlive).DialContext
+	}
+
 	c := &HTTPClient{
 		Client: &http.Client{
-			Timeout: timeout,
-			// http.DefaultTransport + (DisableKeepAlives: true) [ver >= go1.11: + SO_REUSEADDR]
-			Transport: &http.Transport{
-				Proxy:                 http.ProxyFromEnvironment,
-				Dial:                  dialer(localAddr).Dial,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				DisableKeepAlives:     true,
-				TLSClientConfig:       tlsConfig,
-			},
+			Timeout:   opts.Timeout,
+			Transport: t,
 		},
-		FollowRedirect: autoRedirect,
+		FollowRedirect: opts.FollowRedirect,
 	}
 	if !c.FollowRedirect {
 		c.CheckRedirect = c.checkRedirectError
@@ -325,24 +668,22 @@ func newClient(timeout time.Duration, autoRedirect bool, localAddr net.Addr, tls
 	return c
 }
 
-func newClientWithUds(timeout time.Duration, autoRedirect bool, sockFile string) *HTTPClient {
-	c := &HTTPClient{
-		Client: &http.Client{
-			Transport: &http.Transport{
-				Dial: func(__, _ string) (net.Conn, error) {
-					return net.Dial("unix", sockFile)
-				},
-				DisableKeepAlives: true,
-			},
-			Timeout: timeout,
-		},
-		FollowRedirect: autoRedirect,
-	}
+func newClient(timeout time.Duration, autoRedirect bool, localAddr net.Addr, tlsConfig *tls.Config) *HTTPClient {
+	// http.DefaultTransport + (DisableKeepAlives: true) [ver >= go1.11: + SO_REUSEADDR]
+	opts := DefaultHTTPClientOptions()
+	opts.Timeout = timeout
+	opts.FollowRedirect = autoRedirect
+	opts.LocalAddr = localAddr
+	opts.TLSConfig = tlsConfig
+	return NewHTTPClientWithOptions(opts)
+}
 
-	if !c.FollowRedirect {
-		c.CheckRedirect = c.checkRedirectError
-	}
-	return c
+func newClientWithUds(timeout time.Duration, autoRedirect bool, sockFile string) *HTTPClient {
+	opts := DefaultHTTPClientOptions()
+	opts.Timeout = timeout
+	opts.FollowRedirect = autoRedirect
+	opts.SockFile = sockFile
+	return NewHTTPClientWithOptions(opts)
 }
 
 func (h *HTTPClient) isRedirect(err error) bool {
@@ -360,8 +701,50 @@ func (h *HTTPClient) checkRedirectError(req *http.Request, via []*http.Request)
 	return fmt.Errorf(redirectErrorStr)
 }
 
-// Do :
+// Do : X-Request-ID is set from the trace ID of the request context(see RequestIDHandler), if not set
 func (h *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	req = withRequestID(req)
+	if p := h.RetryPolicy; p != nil && p.MaxAttempts > 1 && canRetry(req) {
+		return h.doWithRetry(req, p)
+	}
+	return h.do(req)
+}
+
+func (h *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	if h.metrics != nil {
+		s := time.Now()
+		res, err := h.doWithBreaker(req)
+		h.metrics.observe(req.URL.Host, res, err, time.Since(s))
+		return res, err
+	}
+	return h.doWithBreaker(req)
+}
+
+func (h *HTTPClient) doWithBreaker(req *http.Request) (*http.Response, error) {
+	if h.Breaker == nil {
+		return h.doOnce(req)
+	}
+	done, err := h.Breaker.Allow(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.doOnce(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			// canceled by the caller, neither a success nor a failure of the host
+			done(BreakerIgnored)
+		} else {
+			done(BreakerFailure)
+		}
+	} else if res.StatusCode >= 500 {
+		done(BreakerFailure)
+	} else {
+		done(BreakerSuccess)
+	}
+	return res, err
+}
+
+func (h *HTTPClient) doOnce(req *http.Request) (*http.Response, error) {
 	res, err := h.Client.Do(req)
 	if h.isRedirect(err) {
 		return res, nil
@@ -420,52 +803,84 @@ type HTTPServer struct {
 	Srv             *http.Server
 	Listener        net.Listener
 	AfterShutdownFn func()
+	ShutdownTimeout time.Duration // graceful shutdown timeout of Run, 0: 30 seconds
+
+	conns         *connSet
+	listeners     []*serverListener // by NewMultiListenerHTTPServer, Listener is not used
+	afterShutdown sync.Once         // AfterShutdownFn is called once by Shutdown or Run
 }
 
 // ServeTLS : https
 func (s *HTTPServer) ServeTLS(certFile, keyFile string) error {
-	if s.Listener != nil {
-		return s.Srv.ServeTLS(s.Listener, certFile, keyFile)
+	if len(s.listeners) > 0 {
+		return s.serveListeners(certFile, keyFile)
 	}
-	return s.Srv.ListenAndServeTLS(certFile, keyFile)
+	if s.Listener == nil {
+		addr := s.Srv.Addr
+		if addr == "" {
+			addr = ":https"
+		}
+		l, err := listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		s.Listener = l
+	}
+	UpgradeReady()
+	return s.Srv.ServeTLS(s.Listener, certFile, keyFile)
 }
 
 // Serve :
 func (s *HTTPServer) Serve() error {
-	if s.Listener != nil {
-		return s.Srv.Serve(s.Listener)
+	if len(s.listeners) > 0 {
+		return s.serveListeners("", "")
 	}
-	return s.Srv.ListenAndServe()
+	if s.Listener == nil {
+		addr := s.Srv.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		l, err := listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		s.Listener = l
+	}
+	UpgradeReady()
+	return s.Srv.Serve(s.Listener)
 }
 
-// Shutdown :
+// Shutdown : AfterShutdownFn is called only once, even if Run also shuts down the server
 func (s *HTTPServer) Shutdown(timeout time.Duration) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	s.Srv.Shutdown(ctx)
 
-	if s.AfterShutdownFn != nil {
-		s.AfterShutdownFn()
-	}
+	s.callAfterShutdownFn()
+}
+
+func (s *HTTPServer) callAfterShutdownFn() {
+	s.afterShutdown.Do(func() {
+		if s.AfterShutdownFn != nil {
+			s.AfterShutdownFn()
+		}
+	})
 }
 
 // NewHTTPUnixSocketServer :
 func NewHTTPUnixSocketServer(sockPath string, h http.Handler,
 	shutdownFn func(),
 	connStateFn func(net.Conn, http.ConnState)) (*HTTPServer, error) {
-	if err := os.RemoveAll(sockPath); err != nil {
-		return nil, fmt.Errorf("failed to remove unix socket file [%v], %v", sockPath, err)
-	}
-	l, err := net.Listen("unix", sockPath)
+	l, err := listenUnix(sockPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to listen with unix domain socket [%v], %v", sockPath, err)
+		return nil, err
 	}
 	return &HTTPServer{
 		Srv:      &http.Server{Handler: h, ConnState: connStateFn},
 		Listener: l,
 		AfterShutdownFn: func() {
-			os.RemoveAll(sockPath)
+			removeUnixSocket(sockPath)
 			if shutdownFn != nil {
 				shutdownFn()
 			}
@@ -477,18 +892,15 @@ func NewHTTPUnixSocketServer(sockPath string, h http.Handler,
 func NewLimitHTTPUnixSocketServer(sockPath string, h http.Handler, n int,
 	shutdownFn func(),
 	connStateFn func(net.Conn, http.ConnState)) (*HTTPServer, error) {
-	if err := os.RemoveAll(sockPath); err != nil {
-		return nil, fmt.Errorf("failed to remove unix socket file [%v], %v", sockPath, err)
-	}
-	l, err := net.Listen("unix", sockPath)
+	l, err := listenUnix(sockPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to listen with unix domain socket [%v], %v", sockPath, err)
+		return nil, err
 	}
 	return &HTTPServer{
 		Srv:      &http.Server{Handler: h, ConnState: connStateFn},
 		Listener: netutil.LimitListener(l, n),
 		AfterShutdownFn: func() {
-			os.RemoveAll(sockPath)
+			removeUnixSocket(sockPath)
 			if shutdownFn != nil {
 				shutdownFn()
 			}
@@ -522,7 +934,7 @@ func NewLimitHTTPServer(addr string, h http.Handler, n int,
 	if addr == "" {
 		addr = ":http"
 	}
-	l, err := net.Listen("tcp", addr)
+	l, err := listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen with socket [%v], %v", addr, err)
 	}
@@ -12,7 +12,7 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func dialer(localAddr net.Addr) *net.Dialer {
+func dialer(localAddr net.Addr, timeout, keepAlive time.Duration) *net.Dialer {
 	control := func(network, address string, c syscall.RawConn) error {
 		var err error
 		c.Control(func(fd uintptr) {
@@ -25,8 +25,8 @@ func dialer(localAddr net.Addr) *net.Dialer {
 	}
 	return &net.Dialer{
 		LocalAddr: localAddr,
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
 		Control:   control,
 	}
 }
@@ -10,10 +10,10 @@ import (
 	"time"
 )
 
-func dialer(localAddr net.Addr) *net.Dialer {
+func dialer(localAddr net.Addr, timeout, keepAlive time.Duration) *net.Dialer {
 	return &net.Dialer{
 		LocalAddr: localAddr,
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
 	}
 }
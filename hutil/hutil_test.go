@@ -4,8 +4,10 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -102,6 +104,24 @@ func TestSetOriginRequestHeader(t *testing.T) {
 	assert.Equal(t, []string{"b1", "b2"}, origin["Bbb"])
 }
 
+func TestSetOriginRequestHeader_hopByHop(t *testing.T) {
+	origin := http.Header{}
+	client := http.Header{}
+
+	client.Set("Connection", "X-Hop, close")
+	client.Set("X-Hop", "hop")
+	client.Set("Keep-Alive", "timeout=5")
+	client.Set("Te", "trailers")
+	client.Set("Upgrade", "websocket")
+	client.Set("Proxy-Authorization", "Basic secret")
+	client.Set("Authorization", "Bearer token")
+
+	SetOriginRequestHeader(&origin, client)
+
+	assert.Equal(t, http.Header{"Authorization": {"Bearer token"}}, origin)
+	assert.Equal(t, "hop", client.Get("X-Hop"))
+}
+
 func isCloseTo(x, y, tolerence time.Duration) bool {
 	return math.Abs(float64(x)-float64(y)) < float64(tolerence)
 }
@@ -252,3 +272,169 @@ func TestRateLimitResponseWriter_WriteNoLimit(t *testing.T) {
 		return
 	}
 }
+
+func TestNewHTTPClientWithOptions_KeepAlive(t *testing.T) {
+	countConns := func(opts HTTPClientOptions) int {
+		var mu sync.Mutex
+		conns := 0
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+			if s == http.StateNew {
+				mu.Lock()
+				conns++
+				mu.Unlock()
+			}
+		}
+		ts.Start()
+		defer ts.Close()
+
+		cl := NewHTTPClientWithOptions(opts)
+		for i := 0; i < 3; i++ {
+			resp, err := cl.Get(ts.URL)
+			require.Nil(t, err)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return conns
+	}
+
+	opts := DefaultHTTPClientOptions()
+	assert.Equal(t, 3, countConns(opts))
+
+	opts.KeepAlive = true
+	opts.MaxIdleConnsPerHost = 4
+	assert.Equal(t, 1, countConns(opts))
+}
+
+func TestMultiRateLimitResponseWriter_Write(t *testing.T) {
+	// server-wide 2000 byte per sec shared by two responses
+	global := ratelimit.NewBucketWithRate(2000, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// per-response 100000 byte per sec
+		perResponse := ratelimit.NewBucketWithRate(100000, 100)
+		buf := make([]byte, 1000)
+		NewMultiRateLimitResponseWriter(w, global, perResponse, nil).Write(buf)
+	}))
+	defer ts.Close()
+
+	s := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(ts.URL)
+			if err == nil {
+				ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(s)
+	expected := 1 * time.Second
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(900ms < v < 1100ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
+
+func TestMultiRateLimitResponseWriter_WriteSlowest(t *testing.T) {
+	// the slowest bucket limits the response
+	fast := ratelimit.NewBucketWithRate(100000, 10)
+	slow := ratelimit.NewBucketWithRate(1000, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 500)
+		NewMultiRateLimitResponseWriter(w, fast, slow).Write(buf)
+	}))
+	defer ts.Close()
+
+	s := time.Now()
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 500, len(b))
+
+	elapsed := time.Since(s)
+	expected := 500 * time.Millisecond
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(400ms < v < 600ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
+
+func TestRateLimitAfterResponseWriter_Write(t *testing.T) {
+	// rate limit 1000 byte per sec after 1000 byte
+	bucket := ratelimit.NewBucketWithRate(1000, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1500)
+		NewRateLimitAfterResponseWriter(w, 1000, bucket).Write(buf)
+	}))
+	defer ts.Close()
+
+	s := time.Now()
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 1500, len(b))
+
+	elapsed := time.Since(s)
+	expected := 500 * time.Millisecond
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(400ms < v < 600ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
+
+func TestRateLimitResponseWriter_AccelLimitRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := NewRateLimitResponseWriter(w, nil)
+		// 1000 byte per sec, the first 100 byte(capacity) are written at once
+		rw.Header().Set(AccelLimitRateHeader, "1000")
+		buf := make([]byte, 500)
+		rw.Write(buf)
+	}))
+	defer ts.Close()
+
+	s := time.Now()
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "", resp.Header.Get(AccelLimitRateHeader))
+
+	elapsed := time.Since(s)
+	expected := 400 * time.Millisecond
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(300ms < v < 500ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
+
+func TestSetResponseLimitRate(t *testing.T) {
+	rec := httptest.NewRecorder()
+	assert.False(t, SetResponseLimitRate(rec, 1000))
+
+	w := NewRateLimitResponseWriter(rec, nil)
+	// w is a wrapper of *RateLimitResponseWriter, exposing the optional interfaces of rec
+	_, isRateLimit := w.(*RateLimitResponseWriter)
+	assert.False(t, isRateLimit)
+	rw, ok := AsRateLimitResponseWriter(w)
+	require.True(t, ok)
+	assert.True(t, SetResponseLimitRate(w, 1000))
+	require.NotNil(t, rw.limit)
+	assert.Equal(t, float64(1000), rw.limit.Rate())
+
+	assert.True(t, SetResponseLimitRate(w, 2000))
+	assert.Equal(t, float64(2000), rw.limit.Rate())
+
+	assert.True(t, SetResponseLimitRate(w, 0))
+	assert.Nil(t, rw.limit)
+}
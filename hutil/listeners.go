@@ -0,0 +1,153 @@
+package hutil
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/netutil"
+)
+
+// ListenerConfig : a listener of NewMultiListenerHTTPServer
+type ListenerConfig struct {
+	Network   string      // "tcp", "tcp4", "tcp6" or "unix", "": "tcp"
+	Addr      string      // address to listen, or socket file path of "unix"
+	TLSConfig *tls.Config // serves https if not nil
+	MaxConns  int         // max connections at once, 0: no limit
+}
+
+// serverListener : listener of HTTPServer with multiple listeners
+type serverListener struct {
+	net.Listener
+	tls      bool   // wrapped by tls.NewListener
+	sockPath string // socket file to remove on shutdown
+}
+
+// NewMultiListenerHTTPServer : HTTPServer serving h on all listeners of configs at once, e.g. tcp for remote clients and
+// unix domain socket for local ones. Serve, Run and Shutdown handle all the listeners together,
+// and socket files are removed after shutdown.
+func NewMultiListenerHTTPServer(configs []ListenerConfig, h http.Handler,
+	shutdownFn func(),
+	connStateFn func(net.Conn, http.ConnState)) (*HTTPServer, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no listener config")
+	}
+	var listeners []*serverListener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+			if l.sockPath != "" {
+				removeUnixSocket(l.sockPath)
+			}
+		}
+	}
+	for _, c := range configs {
+		l, err := listenConfig(c)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return &HTTPServer{
+		Srv:       &http.Server{Handler: h, ConnState: connStateFn},
+		listeners: listeners,
+		AfterShutdownFn: func() {
+			for _, l := range listeners {
+				if l.sockPath != "" {
+					removeUnixSocket(l.sockPath)
+				}
+			}
+			if shutdownFn != nil {
+				shutdownFn()
+			}
+		},
+	}, nil
+}
+
+func listenConfig(c ListenerConfig) (*serverListener, error) {
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	sl := &serverListener{}
+	var l net.Listener
+	var err error
+	switch network {
+	case "unix":
+		if l, err = listenUnix(c.Addr); err != nil {
+			return nil, err
+		}
+		sl.sockPath = c.Addr
+	case "tcp", "tcp4", "tcp6":
+		addr := c.Addr
+		if addr == "" {
+			addr = ":http"
+			if c.TLSConfig != nil {
+				addr = ":https"
+			}
+		}
+		if l, err = listen(network, addr); err != nil {
+			return nil, fmt.Errorf("failed to listen with socket [%v], %v", addr, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network, %s", network)
+	}
+	if c.MaxConns > 0 {
+		l = netutil.LimitListener(l, c.MaxConns)
+	}
+	if c.TLSConfig != nil {
+		l = tls.NewListener(l, c.TLSConfig)
+		sl.tls = true
+	}
+	sl.Listener = l
+	return sl, nil
+}
+
+// Addrs : addresses of the listeners
+func (s *HTTPServer) Addrs() []net.Addr {
+	if len(s.listeners) == 0 {
+		if s.Listener == nil {
+			return nil
+		}
+		return []net.Addr{s.Listener.Addr()}
+	}
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+// serveListeners : serves all the listeners until shutdown, listeners without TLSConfig serve https
+// with certFile and keyFile if not empty. if a listener fails, the others are closed and the error is returned.
+func (s *HTTPServer) serveListeners(certFile, keyFile string) error {
+	UpgradeReady()
+	errCh := make(chan error, len(s.listeners))
+	var wg sync.WaitGroup
+	for _, l := range s.listeners {
+		wg.Add(1)
+		go func(l *serverListener) {
+			defer wg.Done()
+			var err error
+			if certFile != "" && !l.tls {
+				err = s.Srv.ServeTLS(l.Listener, certFile, keyFile)
+			} else {
+				err = s.Srv.Serve(l.Listener)
+			}
+			errCh <- err
+		}(l)
+	}
+
+	err := <-errCh
+	if !errors.Is(err, http.ErrServerClosed) {
+		for _, l := range s.listeners {
+			l.Close()
+		}
+	}
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,161 @@
+package hutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getBody(cl *http.Client, url string) string {
+	resp, err := cl.Get(url)
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return string(b)
+}
+
+// newTestCertificate : self-signed certificate for the test, valid for dnsNames and 127.0.0.1
+func newTestCertificate(t *testing.T, cn string, notAfter time.Time, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestNewMultiListenerHTTPServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multi")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "test.sock")
+
+	cert := newTestCertificate(t, "localhost", time.Now().Add(time.Hour), "localhost")
+	s, err := NewMultiListenerHTTPServer([]ListenerConfig{
+		{Addr: "127.0.0.1:0"},
+		{Addr: "127.0.0.1:0", TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}}},
+		{Network: "unix", Addr: sockPath, MaxConns: 1},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Write([]byte("https"))
+			return
+		}
+		w.Write([]byte("http"))
+	}), nil, nil)
+	require.Nil(t, err)
+	addrs := s.Addrs()
+	require.Len(t, addrs, 3)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve()
+	}()
+
+	cl := &http.Client{Timeout: 3 * time.Second}
+	assert.Equal(t, "http", getBody(cl, "http://"+addrs[0].String()))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	tlsCl := &http.Client{Timeout: 3 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	assert.Equal(t, "https", getBody(tlsCl, "https://"+addrs[1].String()))
+
+	udsCl := &http.Client{Timeout: 3 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", sockPath)
+		},
+	}}
+	assert.Equal(t, "http", getBody(udsCl, "http://unix"))
+
+	s.Shutdown(time.Second)
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+	_, err = os.Stat(sockPath)
+	assert.True(t, os.IsNotExist(err))
+	for _, addr := range addrs[:2] {
+		_, err := net.Dial("tcp", addr.String())
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNewMultiListenerHTTPServer_failed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	dir, err := ioutil.TempDir("", "multi")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "test.sock")
+
+	// the socket of the first config is removed if the second one fails
+	_, err = NewMultiListenerHTTPServer([]ListenerConfig{
+		{Network: "unix", Addr: sockPath},
+		{Addr: l.Addr().String()},
+	}, http.NotFoundHandler(), nil, nil)
+	assert.NotNil(t, err)
+	_, err = os.Stat(sockPath)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = NewMultiListenerHTTPServer([]ListenerConfig{{Network: "udp", Addr: "127.0.0.1:0"}}, http.NotFoundHandler(), nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewMultiListenerHTTPServer(nil, http.NotFoundHandler(), nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServer_RunMultiListener(t *testing.T) {
+	s, err := NewMultiListenerHTTPServer([]ListenerConfig{
+		{Addr: "127.0.0.1:0"},
+		{Addr: "127.0.0.1:0"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), nil, nil)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.Run(ctx)
+		assert.Nil(t, err)
+	}()
+
+	cl := &http.Client{Timeout: 3 * time.Second}
+	for _, addr := range s.Addrs() {
+		assert.Equal(t, "ok", getBody(cl, "http://"+addr.String()))
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("not shut down")
+	}
+}
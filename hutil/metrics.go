@@ -0,0 +1,118 @@
+package hutil
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/castisdev/gcommon/metrics"
+)
+
+// HTTPMetrics : metrics of http server requests, e.g. handler of HTTPServer
+type HTTPMetrics struct {
+	Requests *metrics.CounterVec   // labels: method, code(status class, e.g. "2xx")
+	Duration *metrics.HistogramVec // labels: method
+	BytesIn  *metrics.CounterVec   // request body bytes read, labels: method
+	BytesOut *metrics.CounterVec   // response body bytes, labels: method
+	InFlight *metrics.GaugeVec
+}
+
+// NewHTTPMetrics : metric names are prefixed with namespace, e.g. "myapp_http_requests_total"
+func NewHTTPMetrics(namespace string) *HTTPMetrics {
+	p := metricPrefix(namespace) + "http_"
+	return &HTTPMetrics{
+		Requests: metrics.NewCounterVec(p+"requests_total", "Total number of HTTP requests.", "method", "code"),
+		Duration: metrics.NewHistogramVec(p+"request_duration_seconds", "HTTP request latencies in seconds.", nil, "method"),
+		BytesIn:  metrics.NewCounterVec(p+"request_bytes_total", "Total bytes of HTTP request bodies.", "method"),
+		BytesOut: metrics.NewCounterVec(p+"response_bytes_total", "Total bytes of HTTP response bodies.", "method"),
+		InFlight: metrics.NewGauge(p+"requests_in_flight", "Number of HTTP requests being served."),
+	}
+}
+
+// Register :
+func (m *HTTPMetrics) Register(r *metrics.Registry) error {
+	return r.Register(m.Requests, m.Duration, m.BytesIn, m.BytesOut, m.InFlight)
+}
+
+// Handler : records the requests handled by h
+func (m *HTTPMetrics) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.InFlight.Inc()
+		defer m.InFlight.Dec()
+
+		lw := newLogResponseWriter(w, "", "", r)
+		lw.quiet = true
+		defer func() {
+			method := metricMethod(r.Method)
+			m.Requests.WithLabelValues(method, statusClass(lw.Status())).Inc()
+			m.Duration.WithLabelValues(method).Observe(lw.Duration().Seconds())
+			m.BytesIn.WithLabelValues(method).Add(float64(lw.RequestBytes()))
+			m.BytesOut.WithLabelValues(method).Add(float64(lw.BytesWritten()))
+		}()
+		h.ServeHTTP(WrapResponseWriter(lw, w), r)
+	})
+}
+
+// clientMetrics : metrics of HTTPClient
+type clientMetrics struct {
+	requests *metrics.CounterVec   // labels: host, code(status class, "error" or "circuit_open")
+	duration *metrics.HistogramVec // labels: host
+	retries  *metrics.CounterVec   // labels: host
+}
+
+// RegisterMetrics : registers metrics of the requests of h, labeled by the origin host.
+// metric names are prefixed with namespace, e.g. "myapp_http_client_requests_total".
+// it should be called before h is used.
+func (h *HTTPClient) RegisterMetrics(r *metrics.Registry, namespace string) error {
+	p := metricPrefix(namespace) + "http_client_"
+	m := &clientMetrics{
+		requests: metrics.NewCounterVec(p+"requests_total", "Total number of HTTP client requests.", "host", "code"),
+		duration: metrics.NewHistogramVec(p+"request_duration_seconds", "HTTP client request latencies in seconds.", nil, "host"),
+		retries:  metrics.NewCounterVec(p+"retries_total", "Total number of HTTP client retries.", "host"),
+	}
+	if err := r.Register(m.requests, m.duration, m.retries); err != nil {
+		return err
+	}
+	h.metrics = m
+	return nil
+}
+
+func (m *clientMetrics) observe(host string, res *http.Response, err error, d time.Duration) {
+	code := "error"
+	var coe *CircuitOpenError
+	switch {
+	case err == nil:
+		code = statusClass(res.StatusCode)
+	case errors.As(err, &coe):
+		code = "circuit_open"
+	}
+	m.requests.WithLabelValues(host, code).Inc()
+	if coe == nil {
+		m.duration.WithLabelValues(host).Observe(d.Seconds())
+	}
+}
+
+func metricPrefix(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return namespace + "_"
+}
+
+// metricMethod : methods other than the standard ones are "OTHER", not to increase labels by clients
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return strconv.Itoa(code)
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
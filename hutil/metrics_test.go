@@ -0,0 +1,119 @@
+package hutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castisdev/gcommon/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMetrics(r *metrics.Registry) string {
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	return buf.String()
+}
+
+func TestHTTPMetrics_Handler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := NewHTTPMetrics("test")
+	require.Nil(t, m.Register(reg))
+	assert.NotNil(t, m.Register(reg))
+
+	var inFlight float64
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = m.InFlight.WithLabelValues().Value()
+		ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("abc")))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PROPFIND", "/", nil))
+
+	assert.Equal(t, float64(1), inFlight)
+	assert.Equal(t, float64(0), m.InFlight.WithLabelValues().Value())
+	out := writeMetrics(reg)
+	assert.Contains(t, out, `test_http_requests_total{method="GET",code="2xx"} 1`)
+	assert.Contains(t, out, `test_http_requests_total{method="GET",code="4xx"} 1`)
+	assert.Contains(t, out, `test_http_requests_total{method="OTHER",code="2xx"} 1`)
+	assert.Contains(t, out, `test_http_requests_total{method="POST",code="2xx"} 1`)
+	assert.Contains(t, out, `test_http_request_bytes_total{method="POST"} 3`)
+	assert.Contains(t, out, `test_http_response_bytes_total{method="POST"} 5`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_count{method="GET"} 2`)
+	assert.Contains(t, out, `test_http_requests_in_flight 0`)
+}
+
+func TestHTTPClient_RegisterMetrics(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	reg := metrics.NewRegistry()
+	cl := NewHTTPClient(time.Second, nil, nil)
+	cl.RetryPolicy = NewRetryPolicy(2)
+	cl.RetryPolicy.BaseDelay = time.Millisecond
+	require.Nil(t, cl.RegisterMetrics(reg, ""))
+
+	// 503, and 200 after retry
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := cl.Do(req)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	out := writeMetrics(reg)
+	assert.Contains(t, out, `http_client_requests_total{host="`+host+`",code="2xx"} 1`)
+	assert.Contains(t, out, `http_client_requests_total{host="`+host+`",code="5xx"} 1`)
+	assert.Contains(t, out, `http_client_retries_total{host="`+host+`"} 1`)
+	assert.Contains(t, out, `http_client_request_duration_seconds_count{host="`+host+`"} 2`)
+
+	req, _ = http.NewRequest("GET", "http://127.0.0.1:1/", nil)
+	cl.RetryPolicy = nil
+	_, err = cl.Do(req)
+	assert.NotNil(t, err)
+	assert.Contains(t, writeMetrics(reg), `http_client_requests_total{host="127.0.0.1:1",code="error"} 1`)
+}
+
+func TestAdjustableBucket_RegisterMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	b := NewAdjustableBucket(1000, 100)
+	require.Nil(t, b.RegisterMetrics(reg, "limit"))
+	b.Take(30)
+
+	out := writeMetrics(reg)
+	assert.Contains(t, out, "limit_rate 1000\n")
+	assert.Contains(t, out, "limit_capacity 100\n")
+	assert.Contains(t, out, "limit_taken_total 30\n")
+}
+
+func TestRequestLimiter_RegisterMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	l := NewRequestLimiter(1, 1, true)
+	require.Nil(t, l.RegisterMetrics(reg, "limit_req"))
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	out := writeMetrics(reg)
+	assert.Contains(t, out, `limit_req_requests_total{result="passed"} 2`)
+	assert.Contains(t, out, `limit_req_requests_total{result="rejected"} 1`)
+	assert.Contains(t, out, "limit_req_keys 1\n")
+}
@@ -0,0 +1,243 @@
+package hutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MTLSConfig : mutual TLS of HTTPServer, client certificates are verified by the CAs.
+// if both AllowedSubjects and AllowedSANs are empty, any client certificate verified is allowed,
+// otherwise the verified certificate must match one of them, and clients without certificates are rejected.
+type MTLSConfig struct {
+	ClientCAFiles   []string           // PEM files of the CAs of client certificates
+	ClientCAs       *x509.CertPool     // used instead of ClientCAFiles if not nil
+	ClientAuth      tls.ClientAuthType // 0(tls.NoClientCert): tls.RequireAndVerifyClientCert
+	AllowedSubjects []string           // common names or subjects(e.g. "CN=edge,O=castis")
+	AllowedSANs     []string           // DNS names("*.example.com" matches one label), emails, URIs or IPs
+}
+
+// ServerTLSConfig : tls.Config of the server, getCertificateFn is e.g. GetCertificate of CertStore.
+// AllowedSubjects and AllowedSANs can't be used with tls.RequestClientCert or tls.RequireAnyClientCert,
+// which don't verify client certificates.
+func (c *MTLSConfig) ServerTLSConfig(getCertificateFn func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, error) {
+	auth := c.ClientAuth
+	if auth == tls.NoClientCert {
+		auth = tls.RequireAndVerifyClientCert
+	}
+	if c.hasAllowList() && auth != tls.VerifyClientCertIfGiven && auth != tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("allowed subjects or SANs require verified client certificates, client auth:%v", auth)
+	}
+	pool := c.ClientCAs
+	if pool == nil {
+		var err error
+		if pool, err = loadCertPool(c.ClientCAFiles); err != nil {
+			return nil, err
+		}
+	}
+	return &tls.Config{
+		GetCertificate: getCertificateFn,
+		ClientCAs:      pool,
+		ClientAuth:     auth,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if !c.hasAllowList() {
+				return nil
+			}
+			if len(cs.VerifiedChains) == 0 {
+				return errors.New("verified client certificate is required")
+			}
+			return c.verifyPeer(cs.VerifiedChains[0][0])
+		},
+	}, nil
+}
+
+func (c *MTLSConfig) hasAllowList() bool {
+	return len(c.AllowedSubjects) > 0 || len(c.AllowedSANs) > 0
+}
+
+// verifyPeer : checks the verified client certificate with the allow lists
+func (c *MTLSConfig) verifyPeer(cert *x509.Certificate) error {
+	if !c.hasAllowList() {
+		return nil
+	}
+	for _, s := range c.AllowedSubjects {
+		if s == cert.Subject.CommonName || s == cert.Subject.String() {
+			return nil
+		}
+	}
+	for _, san := range c.AllowedSANs {
+		if matchSAN(san, cert) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate is not allowed, subject:%v, san:%v", cert.Subject, certSANs(cert))
+}
+
+func matchSAN(allowed string, cert *x509.Certificate) bool {
+	allowed = strings.ToLower(allowed)
+	for _, name := range cert.DNSNames {
+		name = strings.ToLower(name)
+		if name == allowed {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") {
+			if i := strings.IndexByte(name, '.'); i > 0 && name[i:] == allowed[1:] {
+				return true
+			}
+		}
+	}
+	for _, san := range certSANs(cert) {
+		if strings.ToLower(san) == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// certSANs : subject alternative names of cert
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// NewMTLSHTTPServer : like NewHTTPServer, HTTPServer of mutual TLS, serve it with ServeTLS("", "") or RunTLS.
+// the verified client identity is in the request context(see PeerIdentityFromContext).
+func NewMTLSHTTPServer(addr string, h http.Handler, mtls *MTLSConfig,
+	shutdownFn func(),
+	connStateFn func(net.Conn, http.ConnState),
+	getCertificateFn func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*HTTPServer, error) {
+	tlsConfig, err := mtls.ServerTLSConfig(getCertificateFn)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPServer{
+		Srv: &http.Server{
+			Addr:      addr,
+			Handler:   PeerIdentityHandler(h),
+			ConnState: connStateFn,
+			TLSConfig: tlsConfig,
+		},
+		Listener:        nil,
+		AfterShutdownFn: shutdownFn,
+	}, nil
+}
+
+// PeerIdentity : client certificate of mutual TLS
+type PeerIdentity struct {
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	IPAddresses    []string
+	Verified       bool              // verified by the CAs, false with tls.RequestClientCert or tls.RequireAnyClientCert
+	Certificate    *x509.Certificate `json:"-"`
+}
+
+type peerIdentityKey struct{}
+
+// PeerIdentityHandler : middleware storing the client certificate identity in the request context,
+// NewMTLSHTTPServer uses it. it's not stored if the client certificate is not given.
+func PeerIdentityHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cert := r.TLS.PeerCertificates[0]
+		id := &PeerIdentity{
+			Subject:        cert.Subject.String(),
+			CommonName:     cert.Subject.CommonName,
+			DNSNames:       cert.DNSNames,
+			EmailAddresses: cert.EmailAddresses,
+			Verified:       len(r.TLS.VerifiedChains) > 0,
+			Certificate:    cert,
+		}
+		for _, u := range cert.URIs {
+			id.URIs = append(id.URIs, u.String())
+		}
+		for _, ip := range cert.IPAddresses {
+			id.IPAddresses = append(id.IPAddresses, ip.String())
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerIdentityKey{}, id)))
+	})
+}
+
+// PeerIdentityFromContext : client certificate identity stored by PeerIdentityHandler
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	id, ok := ctx.Value(peerIdentityKey{}).(*PeerIdentity)
+	return id, ok
+}
+
+// MTLSClientConfig : mutual TLS of HTTPClient, set TLSConfig() to TLSConfig of HTTPClientOptions
+type MTLSClientConfig struct {
+	Certs       *CertStore     // client certificates, reloaded by Reload or Watch of the store
+	RootCAFiles []string       // PEM files of the CAs of servers, empty: system CAs
+	RootCAs     *x509.CertPool // used instead of RootCAFiles if not nil
+	ServerName  string         // name to verify the server certificate, "": host of the request
+}
+
+// TLSConfig : tls.Config of the client, the client certificate is selected on each handshake,
+// so the reloaded certificate is used for new connections.
+func (c *MTLSClientConfig) TLSConfig() (*tls.Config, error) {
+	if c.Certs == nil {
+		return nil, errors.New("no client certificate")
+	}
+	pool := c.RootCAs
+	if pool == nil && len(c.RootCAFiles) > 0 {
+		var err error
+		if pool, err = loadCertPool(c.RootCAFiles); err != nil {
+			return nil, err
+		}
+	}
+	return &tls.Config{
+		RootCAs:              pool,
+		ServerName:           c.ServerName,
+		GetClientCertificate: c.Certs.GetClientCertificate,
+	}, nil
+}
+
+// GetClientCertificate : for GetClientCertificate of tls.Config, the first certificate supported by the server,
+// or the first certificate
+func (s *CertStore) GetClientCertificate(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	set := s.set.Load().(*certSet)
+	if len(set.certs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	for _, c := range set.certs {
+		if cri.SupportsCertificate(c) == nil {
+			return c, nil
+		}
+	}
+	return set.certs[0], nil
+}
+
+func loadCertPool(files []string) (*x509.CertPool, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no CA file")
+	}
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file [%v], %v", f, err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("failed to parse CA file [%v], no certificate", f)
+		}
+	}
+	return pool, nil
+}
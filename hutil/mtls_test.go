@@ -0,0 +1,179 @@
+package hutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMTLSHTTPServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	notAfter := time.Now().Add(time.Hour)
+	write := func(name string, c tls.Certificate) CertFile {
+		f := CertFile{Cert: filepath.Join(dir, name+".crt"), Key: filepath.Join(dir, name+".key")}
+		writeTestCertificate(t, c, f.Cert, f.Key)
+		return f
+	}
+	server := write("server", newTestCertificate(t, "localhost", notAfter, "localhost"))
+	edge := newTestCertificate(t, "edge", notAfter, "edge.example.com")
+	edge2 := newTestCertificate(t, "edge2", notAfter, "edge2.example.com")
+	other := newTestCertificate(t, "other", notAfter, "other.test")
+	edgeFile := write("edge", edge)
+	edge2File := write("edge2", edge2)
+	otherFile := write("other", other)
+
+	certs, err := NewCertStore([]CertFile{server})
+	require.Nil(t, err)
+	s, err := NewMTLSHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := PeerIdentityFromContext(r.Context())
+		if !ok || !id.Verified {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(id.CommonName))
+	}), &MTLSConfig{
+		ClientCAFiles: []string{edgeFile.Cert, edge2File.Cert, otherFile.Cert},
+		AllowedSANs:   []string{"*.example.com"},
+	}, nil, nil, certs.GetCertificate)
+	require.Nil(t, err)
+	s.Listener, err = net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go s.ServeTLS("", "")
+	defer s.Shutdown(time.Second)
+	url := "https://" + s.Listener.Addr().String()
+
+	newClient := func(f CertFile) (*http.Client, *CertStore) {
+		store, err := NewCertStore([]CertFile{f})
+		require.Nil(t, err)
+		tlsConfig, err := (&MTLSClientConfig{Certs: store, RootCAFiles: []string{server.Cert}}).TLSConfig()
+		require.Nil(t, err)
+		opts := DefaultHTTPClientOptions()
+		opts.Timeout = 3 * time.Second
+		opts.TLSConfig = tlsConfig
+		return NewHTTPClientWithOptions(opts).Client, store
+	}
+
+	cl, store := newClient(edgeFile)
+	assert.Equal(t, "edge", getBody(cl, url))
+
+	// reloaded client certificate is used for new connections
+	writeTestCertificate(t, edge2, edgeFile.Cert, edgeFile.Key)
+	require.Nil(t, store.Reload())
+	assert.Equal(t, "edge2", getBody(cl, url))
+
+	// not allowed SAN
+	cl, _ = newClient(otherFile)
+	_, err = cl.Get(url)
+	assert.NotNil(t, err)
+
+	// no client certificate
+	pool, err := loadCertPool([]string{server.Cert})
+	require.Nil(t, err)
+	cl = &http.Client{Timeout: 3 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	_, err = cl.Get(url)
+	assert.NotNil(t, err)
+}
+
+// newForgedCertificate : self-signed, non-CA client certificate claiming dnsName
+func newForgedCertificate(t *testing.T, dnsName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{dnsName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestNewMTLSHTTPServer_unverified(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour)
+	server := newTestCertificate(t, "localhost", notAfter, "localhost")
+	edge := newTestCertificate(t, "edge", notAfter, "edge.example.com")
+	forged := newForgedCertificate(t, "edge.example.com")
+	cas := x509.NewCertPool()
+	cas.AddCert(edge.Leaf)
+
+	// allow lists need verified certificates
+	for _, auth := range []tls.ClientAuthType{tls.RequestClientCert, tls.RequireAnyClientCert} {
+		_, err := NewMTLSHTTPServer("", http.NotFoundHandler(),
+			&MTLSConfig{ClientCAs: cas, ClientAuth: auth, AllowedSANs: []string{"edge.example.com"}}, nil, nil, nil)
+		assert.NotNil(t, err, auth)
+	}
+
+	for _, auth := range []tls.ClientAuthType{tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert} {
+		s, err := NewMTLSHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := PeerIdentityFromContext(r.Context())
+			w.Write([]byte(id.CommonName))
+		}), &MTLSConfig{ClientCAs: cas, ClientAuth: auth, AllowedSANs: []string{"edge.example.com"}},
+			nil, nil, func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &server, nil })
+		require.Nil(t, err)
+		s.Listener, err = net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(t, err)
+		go s.ServeTLS("", "")
+		url := "https://" + s.Listener.Addr().String()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(server.Leaf)
+		newClient := func(certs ...tls.Certificate) *http.Client {
+			return &http.Client{Timeout: 3 * time.Second, Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+			}}
+		}
+		assert.Equal(t, "edge", getBody(newClient(edge), url), auth)
+		// forged certificate of the allowed SAN, not signed by the CAs
+		_, err = newClient(forged).Get(url)
+		assert.NotNil(t, err, auth)
+		// no client certificate
+		_, err = newClient().Get(url)
+		assert.NotNil(t, err, auth)
+		s.Shutdown(time.Second)
+	}
+}
+
+func TestMTLSConfig_verifyPeer(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour)
+	edge := newTestCertificate(t, "edge", notAfter, "edge.example.com").Leaf
+
+	assert.Nil(t, (&MTLSConfig{}).verifyPeer(edge))
+	assert.Nil(t, (&MTLSConfig{AllowedSubjects: []string{"edge"}}).verifyPeer(edge))
+	assert.Nil(t, (&MTLSConfig{AllowedSubjects: []string{"CN=edge"}}).verifyPeer(edge))
+	assert.NotNil(t, (&MTLSConfig{AllowedSubjects: []string{"origin"}}).verifyPeer(edge))
+	assert.Nil(t, (&MTLSConfig{AllowedSANs: []string{"Edge.example.com"}}).verifyPeer(edge))
+	assert.Nil(t, (&MTLSConfig{AllowedSANs: []string{"127.0.0.1"}}).verifyPeer(edge))
+	assert.NotNil(t, (&MTLSConfig{AllowedSANs: []string{"*.com"}}).verifyPeer(edge))
+	assert.Nil(t, (&MTLSConfig{AllowedSubjects: []string{"origin"}, AllowedSANs: []string{"*.example.com"}}).verifyPeer(edge))
+}
+
+func TestMTLSConfig_ServerTLSConfig(t *testing.T) {
+	c, err := (&MTLSConfig{ClientCAFiles: []string{"none.crt"}}).ServerTLSConfig(nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+	_, err = (&MTLSConfig{}).ServerTLSConfig(nil)
+	assert.NotNil(t, err)
+	_, err = (&MTLSClientConfig{}).TLSConfig()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package hutil
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// MultipartRanges : multipart/byteranges body writer for multi-range responses
+type MultipartRanges struct {
+	ranges      []HTTPRange
+	contentType string
+	size        int64
+	boundary    string
+}
+
+// NewMultipartRanges : contentType is the type of the whole content, written as each part's Content-Type
+func NewMultipartRanges(ranges []HTTPRange, contentType string, size int64) *MultipartRanges {
+	return &MultipartRanges{
+		ranges:      ranges,
+		contentType: contentType,
+		size:        size,
+		boundary:    multipart.NewWriter(io.Discard).Boundary(),
+	}
+}
+
+// ContentType : value of the response Content-Type header
+func (m *MultipartRanges) ContentType() string {
+	return "multipart/byteranges; boundary=" + m.boundary
+}
+
+// ContentLength : exact length of the body written by WriteTo
+func (m *MultipartRanges) ContentLength() int64 {
+	var cw countingWriter
+	mw := m.newWriter(&cw)
+	for _, r := range m.ranges {
+		mw.CreatePart(m.partHeader(r))
+		cw += countingWriter(r.Length)
+	}
+	mw.Close()
+	return int64(cw)
+}
+
+// WriteTo : writes every range read from ra as a part of the multipart body
+func (m *MultipartRanges) WriteTo(w io.Writer, ra io.ReaderAt) (int64, error) {
+	cw := &countingWriterTo{w: w}
+	mw := m.newWriter(cw)
+	for _, r := range m.ranges {
+		pw, err := mw.CreatePart(m.partHeader(r))
+		if err != nil {
+			return cw.n, err
+		}
+		n, err := io.Copy(pw, io.NewSectionReader(ra, r.Start, r.Length))
+		if err != nil {
+			return cw.n, err
+		}
+		if n != r.Length {
+			return cw.n, fmt.Errorf("short read of range(%s), %d", r.ContentRange(m.size), n)
+		}
+	}
+	err := mw.Close()
+	return cw.n, err
+}
+
+func (m *MultipartRanges) newWriter(w io.Writer) *multipart.Writer {
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(m.boundary)
+	return mw
+}
+
+func (m *MultipartRanges) partHeader(r HTTPRange) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Range", r.ContentRange(m.size))
+	if m.contentType != "" {
+		h.Set("Content-Type", m.contentType)
+	}
+	return h
+}
+
+// ServeRanges : writes a 206 response of ranges read from ra.
+// one range is written as a single part body, more than one as multipart/byteranges.
+// body is not written for HEAD request.
+func ServeRanges(w http.ResponseWriter, r *http.Request, ra io.ReaderAt, size int64, contentType string, ranges []HTTPRange) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("no range to serve")
+	}
+	if len(ranges) == 1 {
+		ra0 := ranges[0]
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Range", ra0.ContentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ra0.Length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r != nil && r.Method == http.MethodHead {
+			return nil
+		}
+		_, err := io.Copy(w, io.NewSectionReader(ra, ra0.Start, ra0.Length))
+		return err
+	}
+
+	m := NewMultipartRanges(ranges, contentType, size)
+	w.Header().Set("Content-Type", m.ContentType())
+	w.Header().Set("Content-Length", strconv.FormatInt(m.ContentLength(), 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r != nil && r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := m.WriteTo(w, ra)
+	return err
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+type countingWriterTo struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriterTo) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
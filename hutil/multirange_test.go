@@ -0,0 +1,77 @@
+package hutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeRanges_multipart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	ranges, err := ParseRange("bytes=0-9,500-599,-5", int64(len(content)))
+	require.Nil(t, err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err = ServeRanges(rec, req, bytes.NewReader(content), int64(len(content)), "video/mp4", ranges)
+	require.Nil(t, err)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	require.Nil(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for _, r := range ranges {
+		p, err := mr.NextPart()
+		require.Nil(t, err)
+		assert.Equal(t, r.ContentRange(int64(len(content))), p.Header.Get("Content-Range"))
+		assert.Equal(t, "video/mp4", p.Header.Get("Content-Type"))
+		b, err := ioutil.ReadAll(p)
+		require.Nil(t, err)
+		assert.Equal(t, content[r.Start:r.Start+r.Length], b)
+	}
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServeRanges_single(t *testing.T) {
+	content := []byte("0123456789")
+	ranges := []HTTPRange{{Start: 2, Length: 3}}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	err := ServeRanges(rec, req, bytes.NewReader(content), int64(len(content)), "text/plain", ranges)
+	require.Nil(t, err)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "bytes 2-4/10", rec.Header().Get("Content-Range"))
+	assert.Equal(t, "3", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "234", rec.Body.String())
+}
+
+func TestServeRanges_head(t *testing.T) {
+	content := []byte("0123456789")
+	ranges := []HTTPRange{{Start: 0, Length: 2}, {Start: 5, Length: 2}}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("HEAD", "/", nil)
+	err := ServeRanges(rec, req, bytes.NewReader(content), int64(len(content)), "", ranges)
+	require.Nil(t, err)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.NotEqual(t, "", rec.Header().Get("Content-Length"))
+	assert.Equal(t, 0, rec.Body.Len())
+}
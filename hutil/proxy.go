@@ -0,0 +1,333 @@
+package hutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// hopHeaders : hop-by-hop headers, RFC 7230 section 6.1
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders : removes hop-by-hop headers and headers named in Connection
+func removeHopByHopHeaders(h http.Header) {
+	for _, f := range h["Connection"] {
+		for _, sf := range strings.Split(f, ",") {
+			if sf = textproto.TrimString(sf); sf != "" {
+				h.Del(sf)
+			}
+		}
+	}
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
+
+// ReverseProxy : reverse proxy handler forwarding requests to Target
+type ReverseProxy struct {
+	Target          *url.URL    // scheme, host and path prefix of the origin
+	Client          *HTTPClient // must not follow redirects
+	Via             string      // pseudonym of Via header
+	FlushInterval   time.Duration
+	RewriteLocation bool // rewrites Location of redirect responses pointing to Target to the client facing host
+
+	RequestHeaderPolicy  *HeaderPolicy // applied to client request headers, nil: hop-by-hop headers are stripped only
+	ResponseHeaderPolicy *HeaderPolicy // applied to origin response headers, nil: hop-by-hop headers are stripped only
+}
+
+// NewReverseProxy : if client is nil, keep-alive client without timeout and redirect is used.
+// response is flushed every FlushInterval, or after each write if FlushInterval is negative
+// or the response is streamed(unknown length or text/event-stream).
+func NewReverseProxy(target *url.URL, client *HTTPClient) *ReverseProxy {
+	if client == nil {
+		opts := DefaultHTTPClientOptions()
+		opts.FollowRedirect = false
+		opts.KeepAlive = true
+		opts.MaxIdleConnsPerHost = 64
+		client = NewHTTPClientWithOptions(opts)
+	}
+	return &ReverseProxy{
+		Target:          target,
+		Client:          client,
+		Via:             "gcommon",
+		FlushInterval:   100 * time.Millisecond,
+		RewriteLocation: true,
+	}
+}
+
+// ServeHTTP :
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	traceID := requestTraceID(r)
+
+	outReq, err := p.newOriginRequest(r)
+	if err != nil {
+		clog.Errorf1(traceID, "failed to create origin request, %v", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	res, err := p.Client.Do(outReq)
+	if err != nil {
+		if r.Context().Err() != nil {
+			clog.Infof1(traceID, "client canceled, %s %s, %v", r.Method, outReq.URL, err)
+			return
+		}
+		code := http.StatusBadGateway
+		if isTimeoutErr(err) {
+			code = http.StatusGatewayTimeout
+		}
+		clog.Errorf1(traceID, "failed to request origin, %s %s, %v", r.Method, outReq.URL, err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	defer res.Body.Close()
+
+	removeHopByHopHeaders(res.Header)
+	p.ResponseHeaderPolicy.Apply(res.Header)
+	if p.RewriteLocation {
+		if loc := res.Header.Get("Location"); loc != "" {
+			res.Header.Set("Location", p.rewriteLocation(loc, r))
+		}
+	}
+	addVia(res.Header, res.ProtoMajor, res.ProtoMinor, p.Via)
+
+	h := w.Header()
+	for k, vv := range res.Header {
+		h[k] = vv
+	}
+	if len(res.Trailer) > 0 {
+		trailerKeys := make([]string, 0, len(res.Trailer))
+		for k := range res.Trailer {
+			trailerKeys = append(trailerKeys, k)
+		}
+		h.Set("Trailer", strings.Join(trailerKeys, ", "))
+	}
+	w.WriteHeader(res.StatusCode)
+
+	if err := p.copyBody(w, res); err != nil {
+		if r.Context().Err() != nil {
+			clog.Infof1(traceID, "client canceled, %s %s, %v", r.Method, outReq.URL, err)
+			return
+		}
+		clog.Errorf1(traceID, "failed to copy origin response, %s %s, %v", r.Method, outReq.URL, err)
+		// aborts the client connection, the response is already partially written
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, vv := range res.Trailer {
+		for _, v := range vv {
+			h.Add(http.TrailerPrefix+k, v)
+		}
+	}
+}
+
+func (p *ReverseProxy) newOriginRequest(r *http.Request) (*http.Request, error) {
+	u := *p.Target
+	u.Path = joinURLPath(p.Target.Path, r.URL.Path)
+	u.RawPath = ""
+	switch {
+	case p.Target.RawQuery == "":
+		u.RawQuery = r.URL.RawQuery
+	case r.URL.RawQuery != "":
+		u.RawQuery = p.Target.RawQuery + "&" + r.URL.RawQuery
+	}
+
+	body := r.Body
+	if r.ContentLength == 0 {
+		body = nil
+	}
+	outReq, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	outReq.ContentLength = r.ContentLength
+
+	clientHeader := r.Header.Clone()
+	removeHopByHopHeaders(clientHeader)
+	SetOriginRequestHeaderWithPolicy(&outReq.Header, clientHeader, p.RequestHeaderPolicy)
+	if rg := r.Header.Values("Range"); len(rg) > 0 {
+		outReq.Header["Range"] = append([]string(nil), rg...)
+	}
+	// trailers are allowed by the client, e.g. gRPC
+	for _, te := range r.Header.Values("Te") {
+		if strings.Contains(strings.ToLower(te), "trailers") {
+			outReq.Header.Set("Te", "trailers")
+			break
+		}
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		outReq.Header.Set("X-Forwarded-For", ip)
+	}
+	outReq.Header.Set("X-Forwarded-Host", r.Host)
+	outReq.Header.Set("X-Forwarded-Proto", requestScheme(r))
+	addVia(outReq.Header, r.ProtoMajor, r.ProtoMinor, p.Via)
+	return outReq, nil
+}
+
+// rewriteLocation : Location pointing to Target is rewritten to the host of the client request
+func (p *ReverseProxy) rewriteLocation(loc string, r *http.Request) string {
+	u, err := url.Parse(loc)
+	if err != nil || !u.IsAbs() || u.Host != p.Target.Host {
+		return loc
+	}
+	u.Scheme = requestScheme(r)
+	u.Host = r.Host
+	if prefix := strings.TrimSuffix(p.Target.Path, "/"); prefix != "" &&
+		(u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")) {
+		u.Path = u.Path[len(prefix):]
+		u.RawPath = ""
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	return u.String()
+}
+
+func (p *ReverseProxy) copyBody(w http.ResponseWriter, res *http.Response) error {
+	var dst io.Writer = w
+	if f, ok := w.(http.Flusher); ok {
+		latency := p.FlushInterval
+		if res.ContentLength == -1 || strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+			latency = -1
+		}
+		if latency != 0 {
+			mw := &maxLatencyWriter{dst: w, flusher: f, latency: latency}
+			defer mw.stop()
+			dst = mw
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := res.Body.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// maxLatencyWriter : flushes written data after latency, or after each write if latency is negative
+type maxLatencyWriter struct {
+	dst     io.Writer
+	flusher http.Flusher
+	latency time.Duration
+
+	mu      sync.Mutex
+	t       *time.Timer
+	pending bool
+}
+
+func (m *maxLatencyWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.dst.Write(p)
+	if m.latency < 0 {
+		m.flusher.Flush()
+		return n, err
+	}
+	if m.pending {
+		return n, err
+	}
+	if m.t == nil {
+		m.t = time.AfterFunc(m.latency, m.delayedFlush)
+	} else {
+		m.t.Reset(m.latency)
+	}
+	m.pending = true
+	return n, err
+}
+
+func (m *maxLatencyWriter) delayedFlush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.pending {
+		return
+	}
+	m.flusher.Flush()
+	m.pending = false
+}
+
+func (m *maxLatencyWriter) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending {
+		m.flusher.Flush()
+	}
+	m.pending = false
+	if m.t != nil {
+		m.t.Stop()
+	}
+}
+
+func addVia(h http.Header, major, minor int, pseudonym string) {
+	if pseudonym == "" {
+		return
+	}
+	v := fmt.Sprintf("%d.%d %s", major, minor, pseudonym)
+	if major == 0 && minor == 0 {
+		v = "1.1 " + pseudonym
+	}
+	if prior := h.Values("Via"); len(prior) > 0 {
+		v = strings.Join(prior, ", ") + ", " + v
+	}
+	h.Set("Via", v)
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func joinURLPath(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func isTimeoutErr(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
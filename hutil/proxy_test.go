@@ -0,0 +1,127 @@
+package hutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_ServeHTTP(t *testing.T) {
+	var originReq *http.Request
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originReq = r
+		switch r.URL.Path {
+		case "/base/redirect":
+			w.Header().Set("Location", "http://"+r.Host+"/base/moved")
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.Header().Set("Connection", "X-Origin-Hop")
+			w.Header().Set("X-Origin-Hop", "1")
+			w.Header().Set("Keep-Alive", "timeout=5")
+			w.Header().Set("Content-Range", "bytes 0-1/10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("ab"))
+		}
+	}))
+	defer origin.Close()
+
+	target, _ := url.Parse(origin.URL + "/base")
+	proxy := httptest.NewServer(NewReverseProxy(target, nil))
+	defer proxy.Close()
+
+	{
+		req, _ := http.NewRequest("GET", proxy.URL+"/file?q=1", nil)
+		req.Header.Set("Range", "bytes=0-1")
+		req.Header.Set("Connection", "X-Client-Hop")
+		req.Header.Set("X-Client-Hop", "1")
+		req.Header.Set("Proxy-Authorization", "secret")
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("X-Custom", "custom")
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, 206, resp.StatusCode)
+		assert.Equal(t, "ab", string(b))
+		assert.Equal(t, "bytes 0-1/10", resp.Header.Get("Content-Range"))
+		assert.Equal(t, "", resp.Header.Get("X-Origin-Hop"))
+		assert.Equal(t, "1.1 gcommon", resp.Header.Get("Via"))
+
+		assert.Equal(t, "/base/file", originReq.URL.Path)
+		assert.Equal(t, "q=1", originReq.URL.RawQuery)
+		assert.Equal(t, "bytes=0-1", originReq.Header.Get("Range"))
+		assert.Equal(t, "custom", originReq.Header.Get("X-Custom"))
+		assert.Equal(t, "", originReq.Header.Get("X-Client-Hop"))
+		assert.Equal(t, "", originReq.Header.Get("Proxy-Authorization"))
+		assert.Equal(t, "10.0.0.1, 127.0.0.1", originReq.Header.Get("X-Forwarded-For"))
+		assert.Equal(t, "http", originReq.Header.Get("X-Forwarded-Proto"))
+		assert.Equal(t, req.URL.Host, originReq.Header.Get("X-Forwarded-Host"))
+		assert.Equal(t, "1.1 gcommon", originReq.Header.Get("Via"))
+		assert.Equal(t, target.Host, originReq.Host)
+	}
+
+	// Location rewrite
+	{
+		cl := NewHTTPClientWithoutRedirect(5*time.Second, nil, nil)
+		req, _ := http.NewRequest("GET", proxy.URL+"/redirect", nil)
+		resp, err := cl.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, proxy.URL+"/moved", resp.Header.Get("Location"))
+	}
+}
+
+func TestReverseProxy_OriginError(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer origin.Close()
+
+	// timeout
+	{
+		target, _ := url.Parse(origin.URL)
+		proxy := httptest.NewServer(NewReverseProxy(target, NewHTTPClientWithoutRedirect(50*time.Millisecond, nil, nil)))
+		defer proxy.Close()
+
+		resp, err := http.Get(proxy.URL)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	}
+
+	// connection refused
+	{
+		closed := httptest.NewServer(http.NotFoundHandler())
+		target, _ := url.Parse(closed.URL)
+		closed.Close()
+		proxy := httptest.NewServer(NewReverseProxy(target, nil))
+		defer proxy.Close()
+
+		resp, err := http.Get(proxy.URL)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+}
+
+func TestReverseProxy_rewriteLocation(t *testing.T) {
+	target, _ := url.Parse("http://origin:8080/api")
+	p := NewReverseProxy(target, nil)
+	r := httptest.NewRequest("GET", "http://edge/x", nil)
+
+	assert.Equal(t, "http://edge/x", p.rewriteLocation("http://origin:8080/api/x", r))
+	assert.Equal(t, "http://edge/", p.rewriteLocation("http://origin:8080/api", r))
+	// not under the path prefix
+	assert.Equal(t, "http://edge/apiv2/x", p.rewriteLocation("http://origin:8080/apiv2/x", r))
+	// other host or relative
+	assert.Equal(t, "http://other/api/x", p.rewriteLocation("http://other/api/x", r))
+	assert.Equal(t, "/api/x", p.rewriteLocation("/api/x", r))
+}
@@ -0,0 +1,177 @@
+package hutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/castisdev/gcommon/metrics"
+	"github.com/juju/ratelimit"
+)
+
+// RateLimiter : token bucket of rate limited writers, *ratelimit.Bucket and *AdjustableBucket implement it
+type RateLimiter interface {
+	// Take takes count tokens and returns the time to wait until they are available
+	Take(count int64) time.Duration
+	// Capacity is the largest count to take at once
+	Capacity() int64
+}
+
+// AdjustableBucket : token bucket whose rate and capacity can be changed while in use.
+// a new rate takes effect from the next Take, so in-flight writers follow it
+// within one refill interval(capacity / rate).
+type AdjustableBucket struct {
+	mu       sync.Mutex
+	rate     float64 // tokens per second, <= 0: no limit
+	capacity int64
+	tokens   float64
+	last     time.Time
+	taken    int64
+}
+
+// AdjustableBucketStats :
+type AdjustableBucketStats struct {
+	Rate      float64 `json:"rate"`
+	Capacity  int64   `json:"capacity"`
+	Available int64   `json:"available"`
+}
+
+// NewAdjustableBucket : bucket is initially full, rate <= 0 means no limit
+func NewAdjustableBucket(rate float64, capacity int64) *AdjustableBucket {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &AdjustableBucket{rate: rate, capacity: capacity, tokens: float64(capacity), last: time.Now()}
+}
+
+// Take :
+func (b *AdjustableBucket) Take(count int64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.taken += count
+	if b.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	b.refill(now)
+	b.tokens -= float64(count)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Capacity :
+func (b *AdjustableBucket) Capacity() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.capacity
+}
+
+// Rate : tokens per second
+func (b *AdjustableBucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// Available : available tokens, negative if tokens are taken in advance
+func (b *AdjustableBucket) Available() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	return int64(b.tokens)
+}
+
+// Stats :
+func (b *AdjustableBucket) Stats() AdjustableBucketStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	return AdjustableBucketStats{Rate: b.rate, Capacity: b.capacity, Available: int64(b.tokens)}
+}
+
+// SetRate : rate <= 0 means no limit
+func (b *AdjustableBucket) SetRate(rate float64, capacity int64) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	if b.rate <= 0 {
+		// bucket is full while no limit
+		b.tokens = float64(capacity)
+	}
+	b.rate = rate
+	b.capacity = capacity
+	if b.tokens > float64(capacity) {
+		b.tokens = float64(capacity)
+	}
+}
+
+// RegisterMetrics : registers metrics of the bucket named with prefix name, e.g. "myapp_download_limit"
+func (b *AdjustableBucket) RegisterMetrics(r *metrics.Registry, name string) error {
+	return r.Register(
+		metrics.NewGaugeFunc(name+"_rate", "Rate of the bucket in tokens per second, 0 or less means no limit.",
+			func() float64 { return b.Rate() }),
+		metrics.NewGaugeFunc(name+"_capacity", "Capacity of the bucket.",
+			func() float64 { return float64(b.Capacity()) }),
+		metrics.NewGaugeFunc(name+"_available", "Available tokens of the bucket, negative if taken in advance.",
+			func() float64 { return float64(b.Available()) }),
+		metrics.NewCounterFunc(name+"_taken_total", "Total tokens taken from the bucket.",
+			func() float64 {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+				return float64(b.taken)
+			}),
+	)
+}
+
+func (b *AdjustableBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if b.rate <= 0 || elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed.Seconds() * b.rate
+	if b.tokens > float64(b.capacity) {
+		b.tokens = float64(b.capacity)
+	}
+}
+
+// limitersUnit : size to take at once, the smallest capacity of the limiters
+func limitersUnit(limiters []RateLimiter) int {
+	unit := limiters[0].Capacity()
+	for _, l := range limiters[1:] {
+		if c := l.Capacity(); c < unit {
+			unit = c
+		}
+	}
+	if unit < 1 {
+		unit = 1
+	}
+	return int(unit)
+}
+
+// takeLimiters : takes n tokens from every limiter, and returns the time to wait until all of them are available
+func takeLimiters(limiters []RateLimiter, n int64) time.Duration {
+	var d time.Duration
+	for _, l := range limiters {
+		if w := l.Take(n); w > d {
+			d = w
+		}
+	}
+	return d
+}
+
+func isNilRateLimiter(l RateLimiter) bool {
+	switch t := l.(type) {
+	case nil:
+		return true
+	case *ratelimit.Bucket:
+		return t == nil
+	case *AdjustableBucket:
+		return t == nil
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package hutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjustableBucket_Take(t *testing.T) {
+	b := NewAdjustableBucket(1000, 100)
+	assert.Equal(t, int64(100), b.Available())
+
+	assert.Equal(t, time.Duration(0), b.Take(100))
+	d := b.Take(100)
+	assert.True(t, isCloseTo(d, 100*time.Millisecond, 5*time.Millisecond), "wait %v", d)
+
+	stats := b.Stats()
+	assert.Equal(t, float64(1000), stats.Rate)
+	assert.Equal(t, int64(100), stats.Capacity)
+	assert.True(t, stats.Available < 0)
+
+	// no limit
+	b.SetRate(0, 100)
+	assert.Equal(t, time.Duration(0), b.Take(1000000))
+}
+
+func TestAdjustableBucket_SetRate(t *testing.T) {
+	b := NewAdjustableBucket(1000, 100)
+	b.SetRate(2000, 50)
+	assert.Equal(t, float64(2000), b.Rate())
+	assert.Equal(t, int64(50), b.Capacity())
+	assert.Equal(t, int64(50), b.Available())
+}
+
+func TestRateLimiterResponseWriter_SetRateInFlight(t *testing.T) {
+	// 1000 byte per sec, 2000 byte takes about 2 sec without change
+	b := NewAdjustableBucket(1000, 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 2000)
+		NewRateLimiterResponseWriter(w, 0, b).Write(buf)
+	}))
+	defer ts.Close()
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		b.SetRate(100000, 1000)
+	}()
+
+	s := time.Now()
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 2000, len(body))
+
+	elapsed := time.Since(s)
+	if elapsed > 600*time.Millisecond {
+		t.Errorf("elapsed expected(less than 600ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
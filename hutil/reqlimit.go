@@ -0,0 +1,245 @@
+package hutil
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+	"github.com/castisdev/gcommon/metrics"
+)
+
+// ParseCIDRs : parses CIDRs or IP addresses(e.g. "10.0.0.0/8", "192.168.0.1")
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address, %s", s)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR, %s", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ClientIP : IP address of the client. X-Forwarded-For is respected only when the peer is one of the trusted proxies,
+// and the last address which is not a trusted proxy is returned.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := remoteIP(r)
+	if len(trustedProxies) == 0 || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyByHeader : RequestLimiter key of the request header value
+func KeyByHeader(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RequestLimiter : request rate limiting middleware like nginx limit_req.
+// requests exceeding Rate are delayed up to Burst(or served at once with NoDelay),
+// and rejected with 429 and Retry-After beyond Burst.
+// the key table is bounded by MaxKeys(least recently used key is removed) and TTL.
+type RequestLimiter struct {
+	Rate           float64 // requests per second
+	Burst          int
+	NoDelay        bool
+	KeyFunc        func(r *http.Request) string // nil: client IP, requests of empty key are not limited
+	TrustedProxies []*net.IPNet                 // X-Forwarded-For is respected from them for the client IP
+	MaxKeys        int
+	TTL            time.Duration // 0: time for Burst to drain, after which a key is the same as a new one
+
+	mu      sync.Mutex
+	lru     *list.List
+	table   map[string]*list.Element
+	results *metrics.CounterVec
+}
+
+type reqLimitEntry struct {
+	key    string
+	excess float64 // requests in excess of Rate
+	last   time.Time
+}
+
+// NewRequestLimiter :
+func NewRequestLimiter(rate float64, burst int, nodelay bool) *RequestLimiter {
+	return &RequestLimiter{Rate: rate, Burst: burst, NoDelay: nodelay, MaxKeys: 100000}
+}
+
+// Handler :
+func (l *RequestLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		if l.KeyFunc != nil {
+			key = l.KeyFunc(r)
+		} else {
+			key = ClientIP(r, l.TrustedProxies)
+		}
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		delay, retryAfter, ok := l.take(key, time.Now())
+		if l.results != nil {
+			switch {
+			case !ok:
+				l.results.WithLabelValues("rejected").Inc()
+			case delay > 0:
+				l.results.WithLabelValues("delayed").Inc()
+			default:
+				l.results.WithLabelValues("passed").Inc()
+			}
+		}
+		if !ok {
+			clog.Debugf1(requestTraceID(r), "request limited, key[%s], %s %s", key, r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RegisterMetrics : registers metrics of the limiter named with prefix name, e.g. "myapp_limit_req".
+// it should be called before the handler is used.
+func (l *RequestLimiter) RegisterMetrics(r *metrics.Registry, name string) error {
+	results := metrics.NewCounterVec(name+"_requests_total", "Total number of requests by the result(passed, delayed or rejected).", "result")
+	keys := metrics.NewGaugeFunc(name+"_keys", "Number of keys in the table.", func() float64 { return float64(l.Len()) })
+	if err := r.Register(results, keys); err != nil {
+		return err
+	}
+	l.results = results
+	return nil
+}
+
+// Len : number of keys in the table
+func (l *RequestLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lru == nil {
+		return 0
+	}
+	return l.lru.Len()
+}
+
+// take : returns the delay of an accepted request, or the time to retry of a rejected request
+func (l *RequestLimiter) take(key string, now time.Time) (delay, retryAfter time.Duration, ok bool) {
+	if l.Rate <= 0 {
+		return 0, 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lru == nil {
+		l.lru = list.New()
+		l.table = make(map[string]*list.Element)
+	}
+	l.expire(now)
+
+	el, exists := l.table[key]
+	if !exists {
+		l.table[key] = l.lru.PushFront(&reqLimitEntry{key: key, last: now})
+		for l.MaxKeys > 0 && l.lru.Len() > l.MaxKeys {
+			l.remove(l.lru.Back())
+		}
+		return 0, 0, true
+	}
+
+	e := el.Value.(*reqLimitEntry)
+	excess := e.excess - l.Rate*now.Sub(e.last).Seconds() + 1
+	if excess < 0 {
+		excess = 0
+	}
+	if excess > float64(l.Burst) {
+		return 0, secondsToDuration((excess - float64(l.Burst)) / l.Rate), false
+	}
+	e.excess = excess
+	e.last = now
+	l.lru.MoveToFront(el)
+
+	if l.NoDelay {
+		return 0, 0, true
+	}
+	return secondsToDuration(excess / l.Rate), 0, true
+}
+
+// expire : removes keys idle longer than TTL from the least recently used
+func (l *RequestLimiter) expire(now time.Time) {
+	ttl := l.TTL
+	if ttl <= 0 {
+		ttl = secondsToDuration(float64(l.Burst+1) / l.Rate)
+	}
+	for el := l.lru.Back(); el != nil; el = l.lru.Back() {
+		if now.Sub(el.Value.(*reqLimitEntry).last) <= ttl {
+			break
+		}
+		l.remove(el)
+	}
+}
+
+func (l *RequestLimiter) remove(el *list.Element) {
+	l.lru.Remove(el)
+	delete(l.table, el.Value.(*reqLimitEntry).key)
+}
+
+func secondsToDuration(sec float64) time.Duration {
+	return time.Duration(sec * float64(time.Second))
+}
@@ -0,0 +1,183 @@
+package hutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.0.1", "::1"})
+	require.Nil(t, err)
+	require.Len(t, nets, 3)
+	assert.True(t, containsIP(nets, "10.1.2.3"))
+	assert.True(t, containsIP(nets, "192.168.0.1"))
+	assert.False(t, containsIP(nets, "192.168.0.2"))
+	assert.True(t, containsIP(nets, "::1"))
+
+	_, err = ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err)
+	_, err = ParseCIDRs([]string{"host"})
+	assert.NotNil(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	require.Nil(t, err)
+
+	cases := []struct {
+		remoteAddr string
+		xff        []string
+		trusted    bool
+		expected   string
+	}{
+		{"1.1.1.1:1234", nil, true, "1.1.1.1"},
+		{"1.1.1.1:1234", []string{"2.2.2.2"}, true, "1.1.1.1"}, // untrusted peer
+		{"1.1.1.1:1234", []string{"2.2.2.2"}, false, "1.1.1.1"},
+		{"10.0.0.1:1234", []string{"2.2.2.2"}, false, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"2.2.2.2"}, true, "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"3.3.3.3, 2.2.2.2, 10.0.0.2"}, true, "2.2.2.2"}, // spoofed 3.3.3.3 is ignored
+		{"10.0.0.1:1234", []string{"3.3.3.3", "2.2.2.2, 10.0.0.2"}, true, "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, true, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"2.2.2.2, garbage"}, true, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, v := range c.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		var proxies = trusted
+		if !c.trusted {
+			proxies = nil
+		}
+		assert.Equal(t, c.expected, ClientIP(r, proxies), "%v", c)
+	}
+}
+
+func TestRequestLimiter_take(t *testing.T) {
+	l := NewRequestLimiter(10, 2, false)
+	now := time.Now()
+
+	d, _, ok := l.take("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+	d, _, ok = l.take("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, d)
+	d, _, ok = l.take("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, 200*time.Millisecond, d)
+	_, retryAfter, ok := l.take("a", now)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, retryAfter)
+
+	// other key is not limited
+	_, _, ok = l.take("b", now)
+	assert.True(t, ok)
+
+	// excess is drained at Rate
+	d, _, ok = l.take("a", now.Add(100*time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, 200*time.Millisecond, d)
+}
+
+func TestRequestLimiter_takeNoDelay(t *testing.T) {
+	l := NewRequestLimiter(10, 1, true)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		d, _, ok := l.take("a", now)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), d)
+	}
+	_, _, ok := l.take("a", now)
+	assert.False(t, ok)
+}
+
+func TestRequestLimiter_bounded(t *testing.T) {
+	l := NewRequestLimiter(10, 0, true)
+	l.MaxKeys = 100
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		l.take(fmt.Sprintf("10.0.%d.%d", i/256, i%256), now)
+	}
+	assert.Equal(t, 100, l.Len())
+
+	// least recently used key is removed
+	_, _, ok := l.take("10.0.3.231", now)
+	assert.False(t, ok)
+	_, _, ok = l.take("10.0.0.0", now)
+	assert.True(t, ok)
+
+	// idle keys are removed after TTL, (Burst+1)/Rate by default
+	l.take("x", now.Add(150*time.Millisecond))
+	assert.Equal(t, 1, l.Len())
+
+	l.TTL = time.Minute
+	l.take("y", now.Add(30*time.Second))
+	assert.Equal(t, 2, l.Len())
+	l.take("z", now.Add(2*time.Minute))
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestRequestLimiter_Handler(t *testing.T) {
+	l := NewRequestLimiter(1, 1, true)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, serve("1.1.1.1:1000").Code)
+	assert.Equal(t, http.StatusOK, serve("1.1.1.1:1001").Code)
+	w := serve("1.1.1.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("2.2.2.2:1000").Code)
+}
+
+func TestRequestLimiter_HandlerDelay(t *testing.T) {
+	l := NewRequestLimiter(20, 1, false)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	s := time.Now()
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.True(t, time.Since(s) >= 50*time.Millisecond)
+}
+
+func TestRequestLimiter_KeyByHeader(t *testing.T) {
+	l := NewRequestLimiter(1, 0, true)
+	l.KeyFunc = KeyByHeader("X-Api-Key")
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(key string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			r.Header.Set("X-Api-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, serve("a"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("a"))
+	assert.Equal(t, http.StatusOK, serve("b"))
+	// requests without key are not limited
+	assert.Equal(t, http.StatusOK, serve(""))
+	assert.Equal(t, http.StatusOK, serve(""))
+}
@@ -0,0 +1,72 @@
+package hutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// RequestIDHeader :
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+// NewRequestID : random 32 hex characters
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDHandler : middleware accepting X-Request-ID of the request or generating a new one.
+// the ID is stored in the request context as the trace ID of clog(clog.TraceID, clog.InfofCtx, ...),
+// echoed in the response, and propagated to origin requests of HTTPClient with the context.
+// invalid IDs(too long or non-printable characters) are replaced, not to break log lines.
+func RequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(clog.WithTraceID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// requestTraceID : trace ID of the request context, or X-Request-ID header
+func requestTraceID(req *http.Request) string {
+	if id := clog.TraceID(req.Context()); id != "" {
+		return id
+	}
+	return req.Header.Get(RequestIDHeader)
+}
+
+// withRequestID : req with X-Request-ID of the context trace ID, if it's not set
+func withRequestID(req *http.Request) *http.Request {
+	id := clog.TraceID(req.Context())
+	if id == "" || req.Header.Get(RequestIDHeader) != "" {
+		return req
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set(RequestIDHeader, id)
+	return r
+}
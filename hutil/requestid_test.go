@@ -0,0 +1,98 @@
+package hutil
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/gcommon/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	var got string
+	h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = clog.TraceID(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "abc-123", got)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+
+	for _, id := range []string{"", "a b", "a\nb", strings.Repeat("a", 129)} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if id != "" {
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Len(t, got, 32)
+		assert.NotEqual(t, id, got)
+		assert.Equal(t, got, w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRequestIDHandler_clog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := cilog.GetWriter()
+	clog.SetWriter(&buf)
+	defer clog.SetWriter(prev)
+
+	h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clog.InfofCtx(r.Context(), "hello %d", 1)
+		clog.InfofCtx(context.Background(), "no trace")
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "trace-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "[trace-1] hello 1")
+	assert.Contains(t, lines[0], "requestid_test.go")
+	assert.Contains(t, lines[1], "no trace")
+	assert.NotContains(t, lines[1], "[]")
+}
+
+func TestHTTPClient_Do_requestID(t *testing.T) {
+	var got []string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(RequestIDHeader))
+	}))
+	defer origin.Close()
+
+	cl := NewHTTPClient(0, nil, nil)
+	front := httptest.NewServer(RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", origin.URL, nil)
+		res, err := cl.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		assert.Equal(t, "", req.Header.Get(RequestIDHeader)) // request of the caller is not modified
+	})))
+	defer front.Close()
+
+	req, _ := http.NewRequest("GET", front.URL, nil)
+	req.Header.Set(RequestIDHeader, "front-id")
+	res, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, "front-id", res.Header.Get(RequestIDHeader))
+
+	// explicit header is kept
+	req, _ = http.NewRequestWithContext(clog.WithTraceID(context.Background(), "ctx-id"), "GET", origin.URL, nil)
+	req.Header.Set(RequestIDHeader, "explicit")
+	res, err = cl.Do(req)
+	require.Nil(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, []string{"front-id", "explicit"}, got)
+}
@@ -0,0 +1,205 @@
+package hutil
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// RetryPolicy : retry policy of HTTPClient.Do.
+// only requests with idempotent methods or rewindable body(GetBody) are retried.
+type RetryPolicy struct {
+	MaxAttempts     int           // including the first attempt
+	BaseDelay       time.Duration // backoff before the first retry, doubled for each retry
+	MaxDelay        time.Duration // upper bound of backoff, not retried if Retry-After is longer
+	RetryableStatus []int
+	RetryNetworkErr bool
+}
+
+// NewRetryPolicy : retries network errors and 429, 502, 503, 504 responses
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		RetryableStatus: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryNetworkErr: true,
+	}
+}
+
+// RetryError : errors of every attempt
+type RetryError struct {
+	Errors []error
+}
+
+// Error :
+func (e *RetryError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("#%d: %v", i+1, err)
+	}
+	return fmt.Sprintf("failed after %d attempts, %s", len(e.Errors), strings.Join(msgs, ", "))
+}
+
+// Unwrap :
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
+
+// backoff : exponential backoff with jitter, retry is 1 for the first retry
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func (p *RetryPolicy) isRetryableStatus(code int) bool {
+	for _, c := range p.RetryableStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) isRetryableErr(err error) bool {
+	if !p.RetryNetworkErr {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return false
+	}
+	var certErr x509.CertificateInvalidError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) {
+		return false
+	}
+	return true
+}
+
+// canRetry : reports whether req can be sent again
+func canRetry(req *http.Request) bool {
+	if !canRewindBody(req) {
+		return false
+	}
+	if req.GetBody != nil {
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != "" {
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter : Retry-After header in delay-seconds or HTTP-date
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(h); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (h *HTTPClient) doWithRetry(req *http.Request, p *RetryPolicy) (*http.Response, error) {
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, &RetryError{Errors: append(errs, fmt.Errorf("failed to rewind body, %v", err))}
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		res, err := h.do(req)
+
+		var attemptErr error
+		var retryAfter time.Duration
+		if err != nil {
+			if !p.isRetryableErr(err) || attempt >= p.MaxAttempts {
+				if len(errs) > 0 {
+					return res, &RetryError{Errors: append(errs, err)}
+				}
+				return res, err
+			}
+			attemptErr = err
+		} else {
+			if !p.isRetryableStatus(res.StatusCode) || attempt >= p.MaxAttempts {
+				return res, nil
+			}
+			attemptErr = fmt.Errorf("response %s", res.Status)
+			retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+			if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+				// not to retry before the time the server asked for
+				clog.Warningf1(requestTraceID(req), "not retried, Retry-After %v is longer than max delay %v, %s %s, %v",
+					retryAfter, p.MaxDelay, req.Method, req.URL, attemptErr)
+				return res, nil
+			}
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+		errs = append(errs, attemptErr)
+
+		delay := p.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		clog.Warningf1(requestTraceID(req), "retry %d/%d after %v, %s %s, %v",
+			attempt+1, p.MaxAttempts, delay, req.Method, req.URL, attemptErr)
+		if h.metrics != nil {
+			h.metrics.retries.WithLabelValues(req.URL.Host).Inc()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, &RetryError{Errors: append(errs, req.Context().Err())}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package hutil
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRetryTestClient(maxAttempts int) *HTTPClient {
+	cl := NewHTTPClient(5*time.Second, nil, nil)
+	cl.RetryPolicy = NewRetryPolicy(maxAttempts)
+	cl.RetryPolicy.BaseDelay = time.Millisecond
+	cl.RetryPolicy.MaxDelay = 10 * time.Millisecond
+	return cl
+}
+
+func TestHTTPClient_Retry(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	{
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		resp, err := newRetryTestClient(3).Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&n))
+	}
+
+	// rewindable body
+	{
+		atomic.StoreInt32(&n, 0)
+		req, _ := http.NewRequest("POST", ts.URL, bytes.NewReader([]byte("body")))
+		resp, err := newRetryTestClient(3).Do(req)
+		require.Nil(t, err)
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "body", string(b))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&n))
+	}
+
+	// not rewindable body
+	{
+		atomic.StoreInt32(&n, 0)
+		req, _ := http.NewRequest("POST", ts.URL, ioutil.NopCloser(bytes.NewReader([]byte("body"))))
+		resp, err := newRetryTestClient(3).Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+	}
+
+	// last response is returned after max attempts
+	{
+		atomic.StoreInt32(&n, 0)
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		resp, err := newRetryTestClient(2).Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&n))
+	}
+}
+
+func TestHTTPClient_RetryNetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	req, _ := http.NewRequest("GET", url, nil)
+	_, err := newRetryTestClient(3).Do(req)
+	require.NotNil(t, err)
+
+	var retryErr *RetryError
+	require.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 3, len(retryErr.Errors))
+}
+
+func TestHTTPClient_RetryAfter(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	cl := newRetryTestClient(2)
+	cl.RetryPolicy.MaxDelay = 2 * time.Second
+	s := time.Now()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	resp, err := cl.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// retried after Retry-After(1s), not after the backoff
+	elapsed := time.Since(s)
+	assert.True(t, elapsed >= time.Second && elapsed < 2*time.Second, "elapsed %v", elapsed)
+}
+
+func TestHTTPClient_RetryAfterOverMaxDelay(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("busy"))
+	}))
+	defer ts.Close()
+
+	cl := newRetryTestClient(3)
+	cl.RetryPolicy.MaxDelay = 200 * time.Millisecond
+	s := time.Now()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	resp, err := cl.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	// not retried before Retry-After, the response is returned
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "busy", string(b))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+	assert.True(t, time.Since(s) < 200*time.Millisecond)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("invalid", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
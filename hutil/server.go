@@ -0,0 +1,155 @@
+package hutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// ShutdownSummary : result of the graceful shutdown of Run
+type ShutdownSummary struct {
+	Signal  os.Signal     // signal which started the shutdown, nil if ctx is done
+	Drained int           // connections closed gracefully
+	Killed  int           // connections closed forcibly after ShutdownTimeout
+	Elapsed time.Duration // time of the shutdown
+}
+
+// String :
+func (s *ShutdownSummary) String() string {
+	return fmt.Sprintf("signal:%v, drained:%d, killed:%d, elapsed:%v", s.Signal, s.Drained, s.Killed, s.Elapsed)
+}
+
+// Run : serves until SIGTERM or SIGINT is received or ctx is done, and then shuts down gracefully.
+// connections not closed in ShutdownTimeout are closed forcibly, and AfterShutdownFn is called.
+// on SIGUSR2(not on windows), the listeners are passed to a new process by Upgrade before the shutdown.
+// http.ErrServerClosed is not an error, it's returned only if the server fails to serve.
+func (s *HTTPServer) Run(ctx context.Context) (*ShutdownSummary, error) {
+	return s.run(ctx, s.Serve)
+}
+
+// RunTLS : like Run, serves https
+func (s *HTTPServer) RunTLS(ctx context.Context, certFile, keyFile string) (*ShutdownSummary, error) {
+	return s.run(ctx, func() error { return s.ServeTLS(certFile, keyFile) })
+}
+
+func (s *HTTPServer) run(ctx context.Context, serve func() error) (*ShutdownSummary, error) {
+	s.trackConns()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, runSignals...)
+	defer signal.Stop(sigCh)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	sum := &ShutdownSummary{}
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			s.callAfterShutdownFn()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return sum, err
+			}
+			return sum, nil
+		case sig := <-sigCh:
+			if isUpgradeSignal(sig) {
+				clog.Infof("received signal %v, upgrading", sig)
+				if err := Upgrade(); err != nil {
+					clog.Errorf("failed to upgrade, %v", err)
+					continue
+				}
+			}
+			sum.Signal = sig
+			clog.Infof("received signal %v, shutting down", sig)
+			break wait
+		case <-ctx.Done():
+			clog.Infof("shutting down, %v", ctx.Err())
+			break wait
+		}
+	}
+
+	s.gracefulShutdown(sum)
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		clog.Errorf("failed to serve, %v", err)
+	}
+	s.callAfterShutdownFn()
+	clog.Infof("shutdown completed, %v", sum)
+	return sum, nil
+}
+
+// gracefulShutdown : shuts down in ShutdownTimeout, and closes the remaining connections
+func (s *HTTPServer) gracefulShutdown(sum *ShutdownSummary) {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	start := time.Now()
+	active := s.conns.len()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Srv.Shutdown(ctx); err != nil {
+		sum.Killed = s.conns.len()
+		clog.Warningf("failed to shutdown gracefully in %v, closing %d connections, %v", timeout, sum.Killed, err)
+		s.Srv.Close()
+	}
+	sum.Drained = active - sum.Killed
+	if sum.Drained < 0 {
+		sum.Drained = 0
+	}
+	sum.Elapsed = time.Since(start)
+}
+
+// trackConns : counts the connections of the server by ConnState, the ConnState of Srv is still called
+func (s *HTTPServer) trackConns() {
+	if s.conns != nil {
+		return
+	}
+	s.conns = &connSet{conns: make(map[net.Conn]struct{})}
+	fn := s.Srv.ConnState
+	s.Srv.ConnState = func(c net.Conn, state http.ConnState) {
+		s.conns.update(c, state)
+		if fn != nil {
+			fn(c, state)
+		}
+	}
+}
+
+// connSet : connections not closed nor hijacked
+type connSet struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (c *connSet) update(conn net.Conn, state http.ConnState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		c.conns[conn] = struct{}{}
+	case http.StateClosed, http.StateHijacked:
+		delete(c.conns, conn)
+	}
+}
+
+func (c *connSet) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.conns)
+}
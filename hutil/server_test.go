@@ -0,0 +1,112 @@
+package hutil
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHTTPServer(t *testing.T, h http.Handler) *HTTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	return &HTTPServer{Srv: &http.Server{Handler: h}, Listener: l}
+}
+
+func TestHTTPServer_Run(t *testing.T) {
+	started := make(chan struct{})
+	s := newTestHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	var afterShutdown bool
+	s.AfterShutdownFn = func() { afterShutdown = true }
+	var mu sync.Mutex
+	var states []http.ConnState
+	s.Srv.ConnState = func(c net.Conn, state http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		sum *ShutdownSummary
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		sum, err := s.Run(ctx)
+		resCh <- result{sum, err}
+	}()
+
+	bodyCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.Listener.Addr().String())
+		if err != nil {
+			bodyCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		bodyCh <- string(b)
+	}()
+	<-started
+	cancel()
+
+	res := <-resCh
+	require.Nil(t, res.err)
+	assert.Equal(t, "done", <-bodyCh)
+	assert.Nil(t, res.sum.Signal)
+	assert.Equal(t, 1, res.sum.Drained)
+	assert.Equal(t, 0, res.sum.Killed)
+	assert.True(t, afterShutdown)
+	// ConnState of the server is still called
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, states, http.StateActive)
+}
+
+func TestHTTPServer_Run_error(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	s, err := NewHTTPServer(l.Addr().String(), http.NotFoundHandler(), nil, nil, nil)
+	require.Nil(t, err)
+	_, err = s.Run(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServer_Run_Shutdown(t *testing.T) {
+	s := newTestHTTPServer(t, http.NotFoundHandler())
+	var called int32
+	s.AfterShutdownFn = func() { atomic.AddInt32(&called, 1) }
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.Run(context.Background())
+		errCh <- err
+	}()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + s.Listener.Addr().String())
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// shut down by the caller, not by Run
+	s.Shutdown(time.Second)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&called))
+}
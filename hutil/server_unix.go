@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package hutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// runSignals : signals handled by Run, SIGUSR2 upgrades the process
+var runSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2}
+
+func isUpgradeSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
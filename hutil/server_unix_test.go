@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package hutil
+
+import (
+	"context"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServer_Run_kill(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s := newTestHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	s.ShutdownTimeout = 100 * time.Millisecond
+
+	go func() {
+		resp, err := http.Get("http://" + s.Listener.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	go func() {
+		<-started
+		syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	}()
+
+	sum, err := s.Run(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, syscall.SIGTERM, sum.Signal)
+	assert.Equal(t, 0, sum.Drained)
+	assert.Equal(t, 1, sum.Killed)
+	assert.True(t, sum.Elapsed >= 100*time.Millisecond)
+}
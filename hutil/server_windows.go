@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package hutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// runSignals : signals handled by Run, upgrade is not supported on windows
+var runSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+
+func isUpgradeSignal(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,155 @@
+package hutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const systemdListenFdsStart = 3
+
+// systemdFiles : files of the listeners passed by systemd socket activation by name, not used yet
+var systemdFiles = struct {
+	sync.Mutex
+	files  map[string][]*os.File
+	parsed bool
+}{}
+
+// parseSystemdFiles : reads LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES once, and unsets them not to be inherited.
+// must be called with systemdFiles locked
+func parseSystemdFiles() error {
+	if systemdFiles.parsed {
+		return nil
+	}
+	systemdFiles.parsed = true
+	systemdFiles.files = make(map[string][]*os.File)
+
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	if pid == "" || fds == "" {
+		return nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// passed to another process
+		return nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid LISTEN_FDS, %s", fds)
+	}
+	var nameList []string
+	if names != "" {
+		nameList = strings.Split(names, ":")
+	}
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+		f := os.NewFile(uintptr(systemdListenFdsStart+i), name)
+		systemdFiles.files[name] = append(systemdFiles.files[name], f)
+	}
+	return nil
+}
+
+// SystemdListenerNames : names of the listeners passed by systemd(FileDescriptorName= of the socket unit), not used yet
+func SystemdListenerNames() ([]string, error) {
+	systemdFiles.Lock()
+	defer systemdFiles.Unlock()
+	if err := parseSystemdFiles(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, files := range systemdFiles.files {
+		for range files {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// systemdListener : listener passed by systemd with the name, each listener is used once.
+// it's registered for Upgrade, so the new process gets it with the same name.
+func systemdListener(name string) (net.Listener, error) {
+	l, err := inheritedListener("systemd", name)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		systemdFiles.Lock()
+		if err := parseSystemdFiles(); err != nil {
+			systemdFiles.Unlock()
+			return nil, err
+		}
+		files := systemdFiles.files[name]
+		if len(files) == 0 {
+			systemdFiles.Unlock()
+			return nil, fmt.Errorf("no systemd listener [%v]", name)
+		}
+		f := files[0]
+		systemdFiles.files[name] = files[1:]
+		systemdFiles.Unlock()
+
+		defer f.Close()
+		if l, err = net.FileListener(f); err != nil {
+			return nil, fmt.Errorf("failed to use systemd listener [%v], %v", name, err)
+		}
+	}
+	return registerListener(l, listenerKey("systemd", name)), nil
+}
+
+// NewHTTPServerFromSystemd : HTTPServer with the TCP listener passed by systemd socket activation.
+// name is FileDescriptorName= of the socket unit, "unknown" if not named.
+func NewHTTPServerFromSystemd(name string, h http.Handler,
+	shutdownFn func(),
+	connStateFn func(net.Conn, http.ConnState),
+	getCertificateFn func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*HTTPServer, error) {
+	l, err := systemdListener(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.(*trackedListener).Listener.(*net.TCPListener); !ok {
+		l.Close()
+		return nil, fmt.Errorf("systemd listener [%v] is not tcp, %v", name, l.Addr())
+	}
+	return &HTTPServer{
+		Srv: &http.Server{
+			Addr:      l.Addr().String(),
+			Handler:   h,
+			ConnState: connStateFn,
+			TLSConfig: &tls.Config{GetCertificate: getCertificateFn},
+		},
+		Listener:        l,
+		AfterShutdownFn: shutdownFn,
+	}, nil
+}
+
+// NewHTTPUnixSocketServerFromSystemd : HTTPServer with the unix domain socket listener passed by systemd socket activation.
+// the socket file is owned by systemd, so it's not removed on shutdown.
+func NewHTTPUnixSocketServerFromSystemd(name string, h http.Handler,
+	shutdownFn func(),
+	connStateFn func(net.Conn, http.ConnState)) (*HTTPServer, error) {
+	l, err := systemdListener(name)
+	if err != nil {
+		return nil, err
+	}
+	ul, ok := l.(*trackedListener).Listener.(*net.UnixListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("systemd listener [%v] is not unix domain socket, %v", name, l.Addr())
+	}
+	ul.SetUnlinkOnClose(false)
+	return &HTTPServer{
+		Srv:             &http.Server{Handler: h, ConnState: connStateFn},
+		Listener:        l,
+		AfterShutdownFn: shutdownFn,
+	}, nil
+}
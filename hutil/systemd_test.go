@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package hutil
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const systemdChildEnv = "GCOMMON_TEST_SYSTEMD_CHILD"
+
+// TestSystemdChildProcess : process started by TestNewHTTPServerFromSystemd like systemd
+func TestSystemdChildProcess(t *testing.T) {
+	if os.Getenv(systemdChildEnv) != "1" {
+		t.Skip("run by TestNewHTTPServerFromSystemd")
+	}
+	names, err := SystemdListenerNames()
+	if err != nil || len(names) != 2 {
+		fmt.Println("invalid names", names, err)
+		os.Exit(1)
+	}
+	h := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "systemd %s", name)
+		})
+	}
+	ts, err := NewHTTPServerFromSystemd("web", h("web"), nil, nil, nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	us, err := NewHTTPUnixSocketServerFromSystemd("local", h("local"), nil, nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err := NewHTTPServerFromSystemd("web", h("web"), nil, nil, nil); err == nil {
+		fmt.Println("listener is used twice")
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go us.Run(ctx)
+	ts.Run(ctx)
+	os.Exit(0)
+}
+
+func TestNewHTTPServerFromSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "test.sock")
+
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer tl.Close()
+	ul, err := net.Listen("unix", sockPath)
+	require.Nil(t, err)
+	defer ul.Close()
+	tf, err := tl.(*net.TCPListener).File()
+	require.Nil(t, err)
+	defer tf.Close()
+	uf, err := ul.(*net.UnixListener).File()
+	require.Nil(t, err)
+	defer uf.Close()
+
+	// LISTEN_PID is the pid of the child, like systemd
+	cmd := exec.Command("sh", "-c", `LISTEN_PID=$$ exec "$0" "$@"`, os.Args[0], "-test.run=^TestSystemdChildProcess$")
+	cmd.Env = append(os.Environ(), systemdChildEnv+"=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=web:local")
+	cmd.ExtraFiles = []*os.File{tf, uf}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	require.Nil(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// connections are queued in the listen socket until the child accepts
+	tcpClient := &http.Client{Timeout: 3 * time.Second}
+	assert.Equal(t, "systemd web", getBody(tcpClient, "http://"+tl.Addr().String()))
+	udsClient := &http.Client{Timeout: 3 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", sockPath)
+		},
+	}}
+	assert.Equal(t, "systemd local", getBody(udsClient, "http://unix"))
+}
+
+func TestSystemdListenerNames_otherPID(t *testing.T) {
+	systemdFiles.Lock()
+	systemdFiles.parsed = false
+	systemdFiles.Unlock()
+	defer func() {
+		systemdFiles.Lock()
+		systemdFiles.parsed = false
+		systemdFiles.Unlock()
+	}()
+
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", "web")
+	names, err := SystemdListenerNames()
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	_, err = NewHTTPServerFromSystemd("web", http.NotFoundHandler(), nil, nil, nil)
+	assert.NotNil(t, err)
+}
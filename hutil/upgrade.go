@@ -0,0 +1,107 @@
+package hutil
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+// listenerRegistry : listeners of HTTPServers to be passed to the new process by Upgrade
+var listenerRegistry = struct {
+	sync.Mutex
+	listeners map[*trackedListener]struct{}
+	inherited map[string]*os.File // from the old process, not used yet
+	parsed    bool
+	upgraded  bool
+	ready     sync.Once
+}{listeners: make(map[*trackedListener]struct{})}
+
+// trackedListener : listener in the registry, removed when closed
+type trackedListener struct {
+	net.Listener
+	key  string
+	once sync.Once
+}
+
+func (l *trackedListener) Close() error {
+	l.once.Do(func() {
+		listenerRegistry.Lock()
+		delete(listenerRegistry.listeners, l)
+		listenerRegistry.Unlock()
+	})
+	return l.Listener.Close()
+}
+
+func listenerKey(network, addr string) string {
+	return network + ":" + addr
+}
+
+// inheritedListener : listener of network and addr passed by the old process, nil if none
+func inheritedListener(network, addr string) (net.Listener, error) {
+	listenerRegistry.Lock()
+	defer listenerRegistry.Unlock()
+	parseInheritedListeners()
+	key := listenerKey(network, addr)
+	f, ok := listenerRegistry.inherited[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(listenerRegistry.inherited, key)
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener [%v], %v", key, err)
+	}
+	clog.Infof("inherited listener [%v]", key)
+	return l, nil
+}
+
+// isInherited : whether the listener of network and addr is passed by the old process
+func isInherited(network, addr string) bool {
+	listenerRegistry.Lock()
+	defer listenerRegistry.Unlock()
+	parseInheritedListeners()
+	_, ok := listenerRegistry.inherited[listenerKey(network, addr)]
+	return ok
+}
+
+// listen : uses the listener passed by the old process if any, and registers the listener for Upgrade
+func listen(network, addr string) (net.Listener, error) {
+	l, err := inheritedListener(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		if l, err = net.Listen(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	return registerListener(l, listenerKey(network, addr)), nil
+}
+
+// registerListener : registers l for Upgrade, the new process gets it by key
+func registerListener(l net.Listener, key string) net.Listener {
+	tl := &trackedListener{Listener: l, key: key}
+	listenerRegistry.Lock()
+	listenerRegistry.listeners[tl] = struct{}{}
+	listenerRegistry.Unlock()
+	return tl
+}
+
+// removeUnixSocket : removes the socket file, unless it's passed to the new process
+func removeUnixSocket(sockPath string) {
+	if IsUpgraded() {
+		return
+	}
+	os.RemoveAll(sockPath)
+}
+
+// IsUpgraded : whether the listeners are passed to a new process by Upgrade
+func IsUpgraded() bool {
+	listenerRegistry.Lock()
+	defer listenerRegistry.Unlock()
+	return listenerRegistry.upgraded
+}
@@ -0,0 +1,115 @@
+//go:build !windows
+// +build !windows
+
+package hutil
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const upgradeChildEnv = "GCOMMON_TEST_UPGRADE_CHILD"
+
+// TestUpgradeChildProcess : new process started by Upgrade in TestUpgrade
+func TestUpgradeChildProcess(t *testing.T) {
+	if os.Getenv(upgradeChildEnv) != "1" {
+		t.Skip("run by TestUpgrade")
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "child")
+	})
+	ts, err := NewLimitHTTPServer(os.Getenv("GCOMMON_TEST_ADDR"), h, 10, nil, nil, nil)
+	if err != nil {
+		os.Exit(1)
+	}
+	us, err := NewHTTPUnixSocketServer(os.Getenv("GCOMMON_TEST_SOCK"), h, nil, nil)
+	if err != nil {
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go us.Run(ctx)
+	ts.Run(ctx)
+	os.Exit(0)
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upgrade")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "test.sock")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "parent")
+	})
+	ts, err := NewLimitHTTPServer(addr, h, 10, nil, nil, nil)
+	require.Nil(t, err)
+	us, err := NewHTTPUnixSocketServer(sockPath, h, nil, nil)
+	require.Nil(t, err)
+	go ts.Serve()
+	go us.Serve()
+
+	tcpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	udsClient := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", sockPath)
+		},
+	}}
+	assert.Equal(t, "parent", getBody(tcpClient, "http://"+addr))
+	assert.Equal(t, "parent", getBody(udsClient, "http://unix"))
+
+	prev := upgradeCommand
+	defer func() { upgradeCommand = prev }()
+	upgradeCommand = func() (*exec.Cmd, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeChildProcess$")
+		return cmd, nil
+	}
+	os.Setenv(upgradeChildEnv, "1")
+	os.Setenv("GCOMMON_TEST_ADDR", addr)
+	os.Setenv("GCOMMON_TEST_SOCK", sockPath)
+	defer os.Unsetenv(upgradeChildEnv)
+
+	require.Nil(t, Upgrade())
+	assert.True(t, IsUpgraded())
+	defer func() {
+		listenerRegistry.Lock()
+		listenerRegistry.upgraded = false
+		listenerRegistry.Unlock()
+	}()
+
+	ts.Shutdown(time.Second)
+	us.Shutdown(time.Second)
+
+	// socket file is kept for the new process
+	_, err = os.Stat(sockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "child", getBody(tcpClient, "http://"+addr))
+	assert.Equal(t, "child", getBody(udsClient, "http://unix"))
+}
+
+func TestUpgrade_failed(t *testing.T) {
+	prev := upgradeCommand
+	defer func() { upgradeCommand = prev }()
+	upgradeCommand = func() (*exec.Cmd, error) {
+		return exec.Command("true"), nil
+	}
+	assert.NotNil(t, Upgrade())
+	assert.False(t, IsUpgraded())
+}
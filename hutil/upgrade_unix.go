@@ -0,0 +1,185 @@
+//go:build !windows
+// +build !windows
+
+package hutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+)
+
+const (
+	// upgradeListenersEnv : keys(network:address) of the inherited listeners separated by ";", fds from 3 in order
+	upgradeListenersEnv = "GCOMMON_UPGRADE_LISTENERS"
+	// upgradeReadyEnv : fd of the pipe to notify that the new process is ready
+	upgradeReadyEnv = "GCOMMON_UPGRADE_READY_FD"
+
+	upgradeTimeout = 30 * time.Second
+)
+
+// upgradeCommand : command of the new process, the same executable and arguments
+var upgradeCommand = func() (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(exe, os.Args[1:]...), nil
+}
+
+// parseInheritedListeners : must be called with the registry locked
+func parseInheritedListeners() {
+	if listenerRegistry.parsed {
+		return
+	}
+	listenerRegistry.parsed = true
+	listenerRegistry.inherited = make(map[string]*os.File)
+	v := os.Getenv(upgradeListenersEnv)
+	if v == "" {
+		return
+	}
+	os.Unsetenv(upgradeListenersEnv)
+	for i, key := range strings.Split(v, ";") {
+		fd := uintptr(3 + i)
+		listenerRegistry.inherited[key] = os.NewFile(fd, key)
+	}
+}
+
+// listenUnix : listens unix domain socket, the socket file is removed first unless it's inherited
+func listenUnix(sockPath string) (net.Listener, error) {
+	if !isInherited("unix", sockPath) {
+		if err := os.RemoveAll(sockPath); err != nil {
+			return nil, fmt.Errorf("failed to remove unix socket file [%v], %v", sockPath, err)
+		}
+	}
+	l, err := listen("unix", sockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen with unix domain socket [%v], %v", sockPath, err)
+	}
+	return l, nil
+}
+
+// UpgradeReady : notifies the old process that this process is ready to serve, then the old process shuts down.
+// it's called by Serve of HTTPServer, and it's no-op if this process is not started by Upgrade.
+func UpgradeReady() {
+	listenerRegistry.ready.Do(func() {
+		v := os.Getenv(upgradeReadyEnv)
+		if v == "" {
+			return
+		}
+		os.Unsetenv(upgradeReadyEnv)
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			clog.Errorf("invalid %s, %s", upgradeReadyEnv, v)
+			return
+		}
+		f := os.NewFile(uintptr(fd), "upgrade-ready")
+		defer f.Close()
+		if _, err := f.Write([]byte{1}); err != nil {
+			clog.Errorf("failed to notify ready to the old process, %v", err)
+		}
+	})
+}
+
+// Upgrade : starts a new process of the same executable and arguments with the listeners of HTTPServers,
+// like the binary upgrade of nginx(USR2). it returns after the new process is ready(UpgradeReady),
+// and then this process should shut down gracefully(Run of HTTPServer does on SIGUSR2).
+// unix socket files are not removed by this process after that.
+func Upgrade() error {
+	listenerRegistry.Lock()
+	defer listenerRegistry.Unlock()
+	if listenerRegistry.upgraded {
+		return nil
+	}
+
+	var keys []string
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for tl := range listenerRegistry.listeners {
+		fl, ok := tl.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("failed to get file of listener [%v], not supported", tl.key)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fmt.Errorf("failed to get file of listener [%v], %v", tl.key, err)
+		}
+		keys = append(keys, tl.key)
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe, %v", err)
+	}
+	defer r.Close()
+
+	cmd, err := upgradeCommand()
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("failed to get executable, %v", err)
+	}
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, upgradeListenersEnv+"=") && !strings.HasPrefix(e, upgradeReadyEnv+"=") {
+			env = append(env, e)
+		}
+	}
+	cmd.Env = append(env,
+		upgradeListenersEnv+"="+strings.Join(keys, ";"),
+		upgradeReadyEnv+"="+strconv.Itoa(3+len(files)))
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), w)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process, %v", err)
+	}
+
+	readyCh := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := r.Read(b); err != nil {
+			readyCh <- fmt.Errorf("new process exited before ready, %v", err)
+			return
+		}
+		readyCh <- nil
+	}()
+	timer := time.NewTimer(upgradeTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-readyCh:
+	case <-timer.C:
+		err = errors.New("new process is not ready in time")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	pid := cmd.Process.Pid
+	// reaps the new process if it exits before this process
+	go cmd.Wait()
+
+	for tl := range listenerRegistry.listeners {
+		if ul, ok := tl.Listener.(*net.UnixListener); ok {
+			// the socket file is used by the new process
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	listenerRegistry.upgraded = true
+	clog.Infof("upgraded, new process pid:%d, listeners:%v", pid, keys)
+	return nil
+}
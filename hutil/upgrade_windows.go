@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package hutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// parseInheritedListeners : listeners are not passed to a new process on windows.
+// must be called with the registry locked
+func parseInheritedListeners() {
+	if listenerRegistry.parsed {
+		return
+	}
+	listenerRegistry.parsed = true
+	listenerRegistry.inherited = make(map[string]*os.File)
+}
+
+// listenUnix : listens unix domain socket, the socket file is removed first
+func listenUnix(sockPath string) (net.Listener, error) {
+	if err := os.RemoveAll(sockPath); err != nil {
+		return nil, fmt.Errorf("failed to remove unix socket file [%v], %v", sockPath, err)
+	}
+	l, err := listen("unix", sockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen with unix domain socket [%v], %v", sockPath, err)
+	}
+	return l, nil
+}
+
+// UpgradeReady : no-op on windows
+func UpgradeReady() {}
+
+// Upgrade : not supported on windows
+func Upgrade() error {
+	return errors.New("upgrade is not supported on windows")
+}
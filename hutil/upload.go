@@ -0,0 +1,177 @@
+package hutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/castisdev/gcommon/clog"
+	"github.com/juju/ratelimit"
+)
+
+// RateLimitRequestBody : rate limited request body.
+// waiting for tokens is canceled with the context, so a stalled upload doesn't block forever.
+type RateLimitRequestBody struct {
+	body     io.ReadCloser
+	ctx      context.Context
+	limiters []RateLimiter
+	n        int64
+}
+
+// NewRateLimitRequestBody : nil limiters are ignored
+func NewRateLimitRequestBody(ctx context.Context, body io.ReadCloser, limiters ...RateLimiter) *RateLimitRequestBody {
+	r := &RateLimitRequestBody{body: body, ctx: ctx}
+	for _, l := range limiters {
+		if !isNilRateLimiter(l) {
+			r.limiters = append(r.limiters, l)
+		}
+	}
+	return r
+}
+
+// Read :
+func (r *RateLimitRequestBody) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(r.limiters) == 0 {
+		n, err := r.body.Read(p)
+		atomic.AddInt64(&r.n, int64(n))
+		return n, err
+	}
+
+	if unit := limitersUnit(r.limiters); len(p) > unit {
+		p = p[:unit]
+	}
+	n, err := r.body.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	if n > 0 {
+		if d := takeLimiters(r.limiters, int64(n)); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-r.ctx.Done():
+				timer.Stop()
+				return n, r.ctx.Err()
+			}
+		}
+	}
+	return n, err
+}
+
+// Close :
+func (r *RateLimitRequestBody) Close() error {
+	return r.body.Close()
+}
+
+// BytesRead :
+func (r *RateLimitRequestBody) BytesRead() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
+// UploadLimiter : middleware limiting the request body rate,
+// per request or per client IP(shared by concurrent requests of the client)
+type UploadLimiter struct {
+	Rate        float64 // bytes per second
+	Capacity    int64   // 0: Rate/10, at least 1
+	PerClientIP bool
+	Limiters    []RateLimiter // shared by all requests, e.g. server-wide limiter
+	// OnComplete is called with the bytes read after the handler returns, nil: logged with clog in debug level
+	OnComplete func(r *http.Request, n int64, elapsed time.Duration)
+
+	mu       sync.Mutex
+	clientIP map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	bucket *ratelimit.Bucket
+	refs   int
+}
+
+// NewUploadLimiter :
+func NewUploadLimiter(rate float64, capacity int64, perClientIP bool) *UploadLimiter {
+	return &UploadLimiter{Rate: rate, Capacity: capacity, PerClientIP: perClientIP}
+}
+
+// Handler :
+func (u *UploadLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		limiters := append([]RateLimiter(nil), u.Limiters...)
+		if u.Rate > 0 {
+			if u.PerClientIP {
+				ip := remoteIP(r)
+				limiters = append(limiters, u.acquire(ip))
+				defer u.release(ip)
+			} else {
+				limiters = append(limiters, u.newBucket())
+			}
+		}
+
+		body := NewRateLimitRequestBody(r.Context(), r.Body, limiters...)
+		r.Body = body
+		s := time.Now()
+		h.ServeHTTP(w, r)
+
+		if u.OnComplete != nil {
+			u.OnComplete(r, body.BytesRead(), time.Since(s))
+		} else {
+			clog.Debugf1(requestTraceID(r), "%s %s, request body %d bytes, %v", r.Method, r.URL.Path, body.BytesRead(), time.Since(s))
+		}
+	})
+}
+
+// newBucket : ratelimit.NewBucketWithRate panics if capacity is not positive
+func (u *UploadLimiter) newBucket() *ratelimit.Bucket {
+	capacity := u.Capacity
+	if capacity <= 0 {
+		capacity = int64(u.Rate / 10)
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	return ratelimit.NewBucketWithRate(u.Rate, capacity)
+}
+
+func (u *UploadLimiter) acquire(ip string) *ratelimit.Bucket {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.clientIP == nil {
+		u.clientIP = make(map[string]*clientLimiter)
+	}
+	cl, ok := u.clientIP[ip]
+	if !ok {
+		cl = &clientLimiter{bucket: u.newBucket()}
+		u.clientIP[ip] = cl
+	}
+	cl.refs++
+	return cl.bucket
+}
+
+// release : limiter of the client IP is removed when no request of the client is in progress
+func (u *UploadLimiter) release(ip string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if cl, ok := u.clientIP[ip]; ok {
+		cl.refs--
+		if cl.refs <= 0 {
+			delete(u.clientIP, ip)
+		}
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
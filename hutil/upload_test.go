@@ -0,0 +1,92 @@
+package hutil
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juju/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitRequestBody_Read(t *testing.T) {
+	// 2000 byte per sec, the first 100 byte(capacity) are read at once
+	bucket := ratelimit.NewBucketWithRate(2000, 100)
+	body := NewRateLimitRequestBody(context.Background(), ioutil.NopCloser(bytes.NewReader(make([]byte, 1000))), bucket)
+
+	s := time.Now()
+	b, err := ioutil.ReadAll(body)
+	require.Nil(t, err)
+	assert.Equal(t, 1000, len(b))
+	assert.Equal(t, int64(1000), body.BytesRead())
+
+	elapsed := time.Since(s)
+	expected := 450 * time.Millisecond
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(350ms < v < 550ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+}
+
+func TestRateLimitRequestBody_Cancel(t *testing.T) {
+	// 10 byte per sec
+	bucket := ratelimit.NewBucketWithRate(10, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	body := NewRateLimitRequestBody(ctx, ioutil.NopCloser(bytes.NewReader(make([]byte, 1000))), bucket)
+
+	s := time.Now()
+	_, err := ioutil.ReadAll(body)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(s) < 500*time.Millisecond)
+}
+
+func TestUploadLimiter_Handler(t *testing.T) {
+	var completed int64
+	u := NewUploadLimiter(2000, 100, true)
+	u.OnComplete = func(r *http.Request, n int64, elapsed time.Duration) {
+		atomic.StoreInt64(&completed, n)
+	}
+	ts := httptest.NewServer(u.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte{byte(len(b) / 100)})
+	})))
+	defer ts.Close()
+
+	s := time.Now()
+	resp, err := http.Post(ts.URL, "application/octet-stream", bytes.NewReader(make([]byte, 1000)))
+	require.Nil(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, []byte{10}, b)
+	assert.Equal(t, int64(1000), atomic.LoadInt64(&completed))
+	assert.True(t, time.Since(s) > 350*time.Millisecond)
+
+	u.mu.Lock()
+	assert.Equal(t, 0, len(u.clientIP))
+	u.mu.Unlock()
+}
+
+func TestUploadLimiter_zeroCapacity(t *testing.T) {
+	for _, perClientIP := range []bool{false, true} {
+		u := NewUploadLimiter(100000, 0, perClientIP)
+		ts := httptest.NewServer(u.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte{byte(len(b) / 100)})
+		})))
+		resp, err := http.Post(ts.URL, "application/octet-stream", bytes.NewReader(make([]byte, 1000)))
+		require.Nil(t, err)
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		assert.Equal(t, []byte{10}, b)
+	}
+	assert.Equal(t, int64(1), (&UploadLimiter{Rate: 5}).newBucket().Capacity())
+	assert.Equal(t, int64(100), (&UploadLimiter{Rate: 1000}).newBucket().Capacity())
+}
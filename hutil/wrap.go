@@ -0,0 +1,167 @@
+package hutil
+
+import (
+	"io"
+	"net/http"
+)
+
+// ResponseWriterWrapper : response writer wrapping another one,
+// optional interfaces are implemented by delegating to the inner writer.
+type ResponseWriterWrapper interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	io.ReaderFrom
+	http.Pusher
+	// Unwrap returns the inner writer, used by http.ResponseController
+	Unwrap() http.ResponseWriter
+}
+
+// WrapResponseWriter : returns w exposing exactly the optional interfaces(http.Flusher, http.Hijacker,
+// io.ReaderFrom and http.Pusher) that inner supports, so that a type assertion of them on the result
+// is as reliable as on inner. Unwrap of the result returns w.
+func WrapResponseWriter(w ResponseWriterWrapper, inner http.ResponseWriter) http.ResponseWriter {
+	const (
+		flusher = 1 << iota
+		hijacker
+		readerFrom
+		pusher
+	)
+	var flags int
+	if _, ok := inner.(http.Flusher); ok {
+		flags |= flusher
+	}
+	if _, ok := inner.(http.Hijacker); ok {
+		flags |= hijacker
+	}
+	if _, ok := inner.(io.ReaderFrom); ok {
+		flags |= readerFrom
+	}
+	if _, ok := inner.(http.Pusher); ok {
+		flags |= pusher
+	}
+
+	u := unwrapper{w}
+	switch flags {
+	case 0:
+		return struct{ unwrapper }{u}
+	case flusher:
+		return struct {
+			unwrapper
+			http.Flusher
+		}{u, w}
+	case hijacker:
+		return struct {
+			unwrapper
+			http.Hijacker
+		}{u, w}
+	case flusher | hijacker:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+		}{u, w, w}
+	case readerFrom:
+		return struct {
+			unwrapper
+			io.ReaderFrom
+		}{u, w}
+	case flusher | readerFrom:
+		return struct {
+			unwrapper
+			http.Flusher
+			io.ReaderFrom
+		}{u, w, w}
+	case hijacker | readerFrom:
+		return struct {
+			unwrapper
+			http.Hijacker
+			io.ReaderFrom
+		}{u, w, w}
+	case flusher | hijacker | readerFrom:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{u, w, w, w}
+	case pusher:
+		return struct {
+			unwrapper
+			http.Pusher
+		}{u, w}
+	case flusher | pusher:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Pusher
+		}{u, w, w}
+	case hijacker | pusher:
+		return struct {
+			unwrapper
+			http.Hijacker
+			http.Pusher
+		}{u, w, w}
+	case flusher | hijacker | pusher:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{u, w, w, w}
+	case readerFrom | pusher:
+		return struct {
+			unwrapper
+			io.ReaderFrom
+			http.Pusher
+		}{u, w, w}
+	case flusher | readerFrom | pusher:
+		return struct {
+			unwrapper
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{u, w, w, w}
+	case hijacker | readerFrom | pusher:
+		return struct {
+			unwrapper
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{u, w, w, w}
+	default:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{u, w, w, w, w}
+	}
+}
+
+// unwrapper : exposes http.ResponseWriter methods of the wrapper only
+type unwrapper struct {
+	w ResponseWriterWrapper
+}
+
+func (u unwrapper) Header() http.Header {
+	return u.w.Header()
+}
+
+func (u unwrapper) Write(b []byte) (int, error) {
+	return u.w.Write(b)
+}
+
+func (u unwrapper) WriteHeader(code int) {
+	u.w.WriteHeader(code)
+}
+
+func (u unwrapper) Unwrap() http.ResponseWriter {
+	return u.w
+}
+
+// writerOnly : hides io.ReaderFrom of the writer, so io.Copy doesn't call ReadFrom recursively
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,153 @@
+package hutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFromRecorder : records the readers passed to ReadFrom
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	srcs []io.Reader
+}
+
+func (r *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.srcs = append(r.srcs, src)
+	return io.Copy(writerOnly{r.ResponseRecorder}, src)
+}
+
+func TestWrapResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	for _, w := range []http.ResponseWriter{
+		NewRateLimitResponseWriter(rec, nil),
+		NewLogResponseWriter(rec, "", "", httptest.NewRequest("GET", "/", nil)),
+	} {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		_, ok = w.(http.Hijacker)
+		assert.False(t, ok)
+		_, ok = w.(io.ReaderFrom)
+		assert.False(t, ok)
+		_, ok = w.(http.Pusher)
+		assert.False(t, ok)
+		_, ok = w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(ResponseWriterWrapper)
+		assert.True(t, ok)
+	}
+
+	w := NewRateLimitResponseWriter(&readFromRecorder{ResponseRecorder: rec}, nil)
+	_, ok := w.(io.ReaderFrom)
+	assert.True(t, ok)
+	_, ok = w.(http.Hijacker)
+	assert.False(t, ok)
+}
+
+func TestAsRateLimitResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := NewRateLimitResponseWriter(rec, nil)
+	w := NewLogResponseWriter(rw, "", "", httptest.NewRequest("GET", "/", nil))
+
+	r, ok := AsRateLimitResponseWriter(w)
+	require.True(t, ok)
+	assert.Same(t, rw.(interface{ Unwrap() http.ResponseWriter }).Unwrap(), r)
+	lw, ok := AsLogResponseWriter(w)
+	require.True(t, ok)
+	assert.Same(t, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap(), lw)
+
+	_, ok = AsRateLimitResponseWriter(rec)
+	assert.False(t, ok)
+	_, ok = AsLogResponseWriter(rw)
+	assert.False(t, ok)
+}
+
+func TestWrapResponseWriter_server(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = NewLogResponseWriter(NewRateLimitResponseWriter(w, nil), "", "", r)
+		_, hijacker := w.(http.Hijacker)
+		_, readerFrom := w.(io.ReaderFrom)
+		if !hijacker || !readerFrom {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// unwrapped to the writer of http server
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRateLimitResponseWriter_ReadFrom(t *testing.T) {
+	f, err := ioutil.TempFile("", "readfrom")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	f.Write(data)
+
+	inner := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	// 1000 byte per sec, the first 100 byte(capacity) are written at once
+	w := NewRateLimitAfterResponseWriter(inner, 300, ratelimit.NewBucketWithQuantum(10*time.Millisecond, 100, 10))
+
+	s := time.Now()
+	n, err := w.(io.ReaderFrom).ReadFrom(io.NewSectionReader(f, 0, 0)) // empty
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	f.Seek(0, io.SeekStart)
+	n, err = w.(io.ReaderFrom).ReadFrom(&io.LimitedReader{R: f, N: int64(len(data))})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, inner.Body.Bytes())
+
+	elapsed := time.Since(s)
+	expected := 600 * time.Millisecond
+	tolerence := 100 * time.Millisecond
+	if !isCloseTo(elapsed, expected, tolerence) {
+		t.Errorf("elapsed expected(500ms < v < 700ms) but(%d)", elapsed.Nanoseconds()/1000000)
+	}
+
+	// chunks are limited files, e.g. for sendfile
+	require.True(t, len(inner.srcs) > 2)
+	for _, src := range inner.srcs[1:] {
+		lr, ok := src.(*io.LimitedReader)
+		require.True(t, ok)
+		_, ok = lr.R.(*os.File)
+		assert.True(t, ok)
+	}
+}
+
+func TestLogResponseWriter_ReadFrom(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lw := newLogResponseWriter(rec, "", "", httptest.NewRequest("GET", "/", nil))
+	// inner writer without ReadFrom
+	n, err := lw.ReadFrom(strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, int64(5), lw.BytesWritten())
+	assert.Equal(t, "hello", rec.Body.String())
+
+	inner := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	lw = newLogResponseWriter(inner, "", "", httptest.NewRequest("GET", "/", nil))
+	n, err = lw.ReadFrom(strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, int64(5), lw.BytesWritten())
+	assert.Len(t, inner.srcs, 1)
+}
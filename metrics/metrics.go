@@ -0,0 +1,372 @@
+// Package metrics : dependency-free counters, gauges and histograms, exposed in Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets : default histogram buckets of latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metric : metric family registered to Registry
+type Metric interface {
+	// Name is the metric family name
+	Name() string
+	describe() *desc
+	write(w *bufio.Writer)
+}
+
+type desc struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+}
+
+func (d *desc) Name() string {
+	return d.name
+}
+
+func (d *desc) describe() *desc {
+	return d
+}
+
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		nv := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, nv) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter : monotonically increasing value
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc :
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add : negative v is ignored, counter doesn't decrease
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.v.add(v)
+}
+
+// Value :
+func (c *Counter) Value() float64 {
+	return c.v.load()
+}
+
+// Gauge : value which can go up and down
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set :
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+
+// Add :
+func (g *Gauge) Add(v float64) {
+	g.v.add(v)
+}
+
+// Inc :
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+// Dec :
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Value :
+func (g *Gauge) Value() float64 {
+	return g.v.load()
+}
+
+// Histogram : counts observations in buckets of upper bounds
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64 // per bucket, not cumulative, last one is +Inf
+	count       uint64
+	sum         atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upperBounds: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe :
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	h.sum.add(v)
+}
+
+// Count : number of observations
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum : sum of observations
+func (h *Histogram) Sum() float64 {
+	return h.sum.load()
+}
+
+func normalizeBuckets(buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	if n := len(b); n > 0 && math.IsInf(b[n-1], 1) {
+		b = b[:n-1]
+	}
+	return b
+}
+
+// vec : children of label values
+type vec struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*child
+	newFn    func() interface{}
+}
+
+type child struct {
+	labelValues []string
+	m           interface{}
+}
+
+// newVec : metric without labels is exposed from the start, e.g. counter of 0
+func newVec(name, help, typ string, labelNames []string, newFn func() interface{}) vec {
+	children := make(map[string]*child)
+	if len(labelNames) == 0 {
+		children[""] = &child{m: newFn()}
+	}
+	return vec{
+		desc:     desc{name: name, help: help, typ: typ, labelNames: labelNames},
+		children: children,
+		newFn:    newFn,
+	}
+}
+
+// with : panics if the number of values differs from the label names, as it's a programming error
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, but %d values", v.name, len(v.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c.m
+	}
+	c = &child{labelValues: append([]string(nil), values...), m: v.newFn()}
+	v.children[key] = c
+	return c.m
+}
+
+// sortedChildren : children sorted by label values, for a stable output
+func (v *vec) sortedChildren() []*child {
+	v.mu.RLock()
+	cs := make([]*child, 0, len(v.children))
+	for _, c := range v.children {
+		cs = append(cs, c)
+	}
+	v.mu.RUnlock()
+	sort.Slice(cs, func(i, j int) bool {
+		a, b := cs[i].labelValues, cs[j].labelValues
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return cs
+}
+
+// CounterVec : counters partitioned by label values
+type CounterVec struct {
+	vec
+}
+
+// NewCounter : counter without labels
+func NewCounter(name, help string) *CounterVec {
+	return NewCounterVec(name, help)
+}
+
+// NewCounterVec :
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labelNames, func() interface{} { return &Counter{} })}
+}
+
+// WithLabelValues : counter of the label values, in the order of the label names
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values).(*Counter)
+}
+
+// Inc : increments the counter without labels
+func (v *CounterVec) Inc() {
+	v.WithLabelValues().Inc()
+}
+
+// Add : adds to the counter without labels
+func (v *CounterVec) Add(f float64) {
+	v.WithLabelValues().Add(f)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	for _, c := range v.sortedChildren() {
+		writeSample(w, v.name, "", v.labelNames, c.labelValues, "", "", c.m.(*Counter).Value())
+	}
+}
+
+// GaugeVec : gauges partitioned by label values
+type GaugeVec struct {
+	vec
+}
+
+// NewGauge : gauge without labels
+func NewGauge(name, help string) *GaugeVec {
+	return NewGaugeVec(name, help)
+}
+
+// NewGaugeVec :
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labelNames, func() interface{} { return &Gauge{} })}
+}
+
+// WithLabelValues : gauge of the label values, in the order of the label names
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values).(*Gauge)
+}
+
+// Set : sets the gauge without labels
+func (v *GaugeVec) Set(f float64) {
+	v.WithLabelValues().Set(f)
+}
+
+// Inc : increments the gauge without labels
+func (v *GaugeVec) Inc() {
+	v.WithLabelValues().Inc()
+}
+
+// Dec : decrements the gauge without labels
+func (v *GaugeVec) Dec() {
+	v.WithLabelValues().Dec()
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	for _, c := range v.sortedChildren() {
+		writeSample(w, v.name, "", v.labelNames, c.labelValues, "", "", c.m.(*Gauge).Value())
+	}
+}
+
+// HistogramVec : histograms partitioned by label values
+type HistogramVec struct {
+	vec
+}
+
+// NewHistogram : histogram without labels, nil buckets means DefBuckets
+func NewHistogram(name, help string, buckets []float64) *HistogramVec {
+	return NewHistogramVec(name, help, buckets)
+}
+
+// NewHistogramVec : nil buckets means DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	b := normalizeBuckets(buckets)
+	return &HistogramVec{newVec(name, help, "histogram", labelNames, func() interface{} { return newHistogram(b) })}
+}
+
+// WithLabelValues : histogram of the label values, in the order of the label names
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values).(*Histogram)
+}
+
+// Observe : observes to the histogram without labels
+func (v *HistogramVec) Observe(f float64) {
+	v.WithLabelValues().Observe(f)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	for _, c := range v.sortedChildren() {
+		h := c.m.(*Histogram)
+		var cumulative uint64
+		for i, ub := range h.upperBounds {
+			cumulative += atomic.LoadUint64(&h.counts[i])
+			writeSample(w, v.name, "_bucket", v.labelNames, c.labelValues, "le", formatFloat(ub), float64(cumulative))
+		}
+		cumulative += atomic.LoadUint64(&h.counts[len(h.upperBounds)])
+		writeSample(w, v.name, "_bucket", v.labelNames, c.labelValues, "le", "+Inf", float64(cumulative))
+		writeSample(w, v.name, "_sum", v.labelNames, c.labelValues, "", "", h.Sum())
+		writeSample(w, v.name, "_count", v.labelNames, c.labelValues, "", "", float64(cumulative))
+	}
+}
+
+// GaugeFunc : gauge whose value is read by fn when exposed, e.g. length of a queue
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc :
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn}
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeSample(w, g.name, "", nil, nil, "", "", g.fn())
+}
+
+// CounterFunc : counter whose value is read by fn when exposed, e.g. counter kept by other package
+type CounterFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewCounterFunc :
+func NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	return &CounterFunc{desc: desc{name: name, help: help, typ: "counter"}, fn: fn}
+}
+
+func (c *CounterFunc) write(w *bufio.Writer) {
+	writeSample(w, c.name, "", nil, nil, "", "", c.fn())
+}
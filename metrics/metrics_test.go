@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("requests_total", "Total requests.", "method", "code")
+	c.WithLabelValues("GET", "2xx").Inc()
+	c.WithLabelValues("GET", "2xx").Add(2)
+	c.WithLabelValues("GET", "2xx").Add(-1)
+	c.WithLabelValues("POST", "5xx").Inc()
+	assert.Equal(t, float64(3), c.WithLabelValues("GET", "2xx").Value())
+	assert.Panics(t, func() { c.WithLabelValues("GET") })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.WithLabelValues("PUT", "2xx").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, float64(10000), c.WithLabelValues("PUT", "2xx").Value())
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("in_flight", "")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	assert.Equal(t, float64(1), g.WithLabelValues().Value())
+	g.Set(-2.5)
+	assert.Equal(t, -2.5, g.WithLabelValues().Value())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("latency_seconds", "", []float64{1, 0.1, math.Inf(1)})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.Observe(v)
+	}
+	hh := h.WithLabelValues()
+	assert.Equal(t, uint64(4), hh.Count())
+	assert.Equal(t, 2.65, hh.Sum())
+	assert.Equal(t, []float64{0.1, 1}, hh.upperBounds)
+	assert.Equal(t, []uint64{2, 1, 1}, hh.counts)
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	require.Nil(t, r.Register(NewCounter("a_total", ""), NewGauge("b", "")))
+	assert.NotNil(t, r.Register(NewCounter("a_total", "")))
+	// none of them is registered
+	assert.NotNil(t, r.Register(NewGauge("c", ""), NewGauge("c", "")))
+	assert.NotNil(t, r.Register(NewGauge("d", ""), NewGauge("1d", "")))
+	assert.Nil(t, r.Register(NewGauge("c", ""), NewGauge("d", "")))
+
+	assert.NotNil(t, r.Register(NewCounterVec("e", "", "bad-label")))
+	assert.NotNil(t, r.Register(NewCounterVec("e", "", "__reserved")))
+	assert.NotNil(t, r.Register(NewHistogramVec("e", "", nil, "le")))
+
+	assert.True(t, r.Unregister("a_total"))
+	assert.False(t, r.Unregister("a_total"))
+	assert.Nil(t, r.Register(NewCounter("a_total", "")))
+	assert.Panics(t, func() { r.MustRegister(NewCounter("a_total", "")) })
+}
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounterVec("http_requests_total", "Total\nrequests.", "method", "path")
+	c.WithLabelValues("GET", `/a"b\`).Add(3)
+	c.WithLabelValues("DELETE", "/").Inc()
+	h := NewHistogramVec("latency_seconds", "", []float64{0.1, 1}, "method")
+	h.WithLabelValues("GET").Observe(0.5)
+	h.WithLabelValues("GET").Observe(0.05)
+	r.MustRegister(c, h, NewGaugeFunc("queue_length", "Queue length.", func() float64 { return 7 }),
+		NewCounter("empty_total", ""), NewCounterFunc("external_total", "", func() float64 { return 1e9 }))
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.Nil(t, err)
+	expected := `# TYPE empty_total counter
+empty_total 0
+# TYPE external_total counter
+external_total 1e+09
+# HELP http_requests_total Total\nrequests.
+# TYPE http_requests_total counter
+http_requests_total{method="DELETE",path="/"} 1
+http_requests_total{method="GET",path="/a\"b\\"} 3
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 1
+latency_seconds_bucket{method="GET",le="1"} 2
+latency_seconds_bucket{method="GET",le="+Inf"} 2
+latency_seconds_sum{method="GET"} 0.55
+latency_seconds_count{method="GET"} 2
+# HELP queue_length Queue length.
+# TYPE queue_length gauge
+queue_length 7
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewCounter("a_total", "A."))
+	ts := httptest.NewServer(Handler(r))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# HELP a_total A.\n# TYPE a_total counter\na_total 0\n", string(b))
+}
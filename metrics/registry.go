@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Registry : set of metrics exposed together
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]Metric
+}
+
+// NewRegistry :
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]Metric)}
+}
+
+// DefaultRegistry :
+var DefaultRegistry = NewRegistry()
+
+// Register : registers all metrics, or none of them if any name is invalid or already registered
+func (r *Registry) Register(ms ...Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make(map[string]bool, len(ms))
+	for _, m := range ms {
+		d := m.describe()
+		if !metricNameRe.MatchString(d.name) {
+			return fmt.Errorf("invalid metric name, %s", d.name)
+		}
+		for _, l := range d.labelNames {
+			if !labelNameRe.MatchString(l) || strings.HasPrefix(l, "__") || (d.typ == "histogram" && l == "le") {
+				return fmt.Errorf("invalid label name of %s, %s", d.name, l)
+			}
+		}
+		if _, ok := r.metrics[d.name]; ok || names[d.name] {
+			return fmt.Errorf("duplicate metric name, %s", d.name)
+		}
+		names[d.name] = true
+	}
+	for _, m := range ms {
+		r.metrics[m.Name()] = m
+	}
+	return nil
+}
+
+// MustRegister : like Register, panics on error
+func (r *Registry) MustRegister(ms ...Metric) {
+	if err := r.Register(ms...); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister :
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; !ok {
+		return false
+	}
+	delete(r.metrics, name)
+	return true
+}
+
+// WriteTo : writes all metrics in Prometheus text format, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	ms := make([]Metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ms = append(ms, m)
+	}
+	r.mu.RUnlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name() < ms[j].Name() })
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for _, m := range ms {
+		d := m.describe()
+		if d.help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", d.name, d.typ)
+		m.write(bw)
+	}
+	bw.Flush()
+	return buf.WriteTo(w)
+}
+
+// Handler : http handler exposing the metrics of r in Prometheus text format
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		r.WriteTo(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		if req.Method == http.MethodHead {
+			return
+		}
+		w.Write(buf.Bytes())
+	})
+}
+
+func writeSample(w *bufio.Writer, name, suffix string, labelNames, labelValues []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	w.WriteString(suffix)
+	if len(labelNames) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabelValue(labelValues[i]))
+			w.WriteByte('"')
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}